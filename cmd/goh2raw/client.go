@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/cpuusage"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/2026-02-http2-perf/internal/tcpinfo"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// clientConfig configures [runClient].
+type clientConfig struct {
+	// Bytes is the number of bytes to fetch.
+	Bytes int64
+
+	// ConnWindow is the connection-level receive window.
+	ConnWindow uint32
+
+	// Duration, if positive, is the duration of the transfer.
+	Duration time.Duration
+
+	// Host is the server endpoint.
+	Host string
+
+	// Interval is the interval between throughput samples.
+	Interval time.Duration
+
+	// Link, if not nil, is the emulated link.
+	Link *linkemu.Config
+
+	// MaxFrameSize is the SETTINGS_MAX_FRAME_SIZE we advertise.
+	MaxFrameSize uint32
+
+	// StreamWindow is the SETTINGS_INITIAL_WINDOW_SIZE we advertise.
+	StreamWindow uint32
+}
+
+// runClient fetches the body using a single stream over a new connection.
+// When the server sends [bench.TrailerBytes] and the related trailers, we
+// also parse and log the server-side measurements.
+//
+// The throughput samples count the bytes read from the connection, which
+// include the frame headers, while the result bytes only count DATA.
+func runClient(ctx context.Context, config *clientConfig) *bench.Result {
+	path := "/" + strconv.FormatInt(config.Bytes, 10)
+	if config.Duration > 0 {
+		path = "/time/" + config.Duration.String()
+	}
+	URL := &url.URL{Scheme: "http", Host: config.Host, Path: path}
+	result := &bench.Result{
+		Method: "GET",
+		Proto:  "HTTP/2.0",
+		Start:  time.Now(),
+		URL:    URL.String(),
+	}
+	slog.Info("request", slog.String("method", result.Method), slog.String("URL", result.URL))
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", config.Host)
+	if err != nil {
+		result.Err = err
+		result.Log("client")
+		return result
+	}
+	conn = config.Link.Conn(conn)
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	result.LocalAddr = conn.LocalAddr().String()
+	sampler := tcpinfo.Start(conn, config.Interval)
+	reader := slogging.NewReadCloser(conn, config.Interval)
+
+	meter := cpuusage.Start()
+	framer := http2.NewFramer(conn, bufio.NewReader(reader))
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	framer.SetMaxReadFrameSize(config.MaxFrameSize)
+	result.Bytes, result.Err = exchange(framer, conn, config, path, result)
+
+	reader.Close()
+	result.Elapsed = time.Since(result.Start)
+	result.Samples = reader.Samples()
+	result.TCPInfo = sampler.Stop()
+	result.CPU = meter.Stop()
+	result.Log("client")
+	result.CPU.Log("cpu", result.Bytes)
+	if result.Server != nil {
+		result.Server.Log()
+	}
+	return result
+}
+
+// exchange sends the request and reads the response, sending WINDOW_UPDATE
+// frames once we have consumed half of each window. It returns the number
+// of DATA bytes received and sets result.Server from the trailers, if any.
+func exchange(framer *http2.Framer, conn net.Conn, config *clientConfig, path string, result *bench.Result) (int64, error) {
+	if _, err := io.WriteString(conn, http2.ClientPreface); err != nil {
+		return 0, err
+	}
+	err := framer.WriteSettings(
+		http2.Setting{ID: http2.SettingEnablePush, Val: 0},
+		http2.Setting{ID: http2.SettingInitialWindowSize, Val: config.StreamWindow},
+		http2.Setting{ID: http2.SettingMaxFrameSize, Val: config.MaxFrameSize},
+	)
+	if err != nil {
+		return 0, err
+	}
+	if config.ConnWindow > initialWindowSize {
+		if err := framer.WriteWindowUpdate(0, config.ConnWindow-initialWindowSize); err != nil {
+			return 0, err
+		}
+	}
+
+	const streamID = 1
+	encbuf := &bytes.Buffer{}
+	encoder := hpack.NewEncoder(encbuf)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "GET"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: config.Host},
+		{Name: ":path", Value: path},
+	} {
+		if err := encoder.WriteField(field); err != nil {
+			return 0, err
+		}
+	}
+	err = framer.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      streamID,
+		BlockFragment: encbuf.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		count, connUnacked, streamUnacked int64
+		gotHeaders                        bool
+	)
+	for {
+		frame, err := framer.ReadFrame()
+		if err != nil {
+			return count, err
+		}
+		switch frame := frame.(type) {
+		case *http2.DataFrame:
+			count += int64(len(frame.Data()))
+			if frame.StreamEnded() {
+				return count, nil
+			}
+			connUnacked += int64(frame.Length)
+			if connUnacked >= int64(config.ConnWindow)/2 {
+				if err := framer.WriteWindowUpdate(0, uint32(connUnacked)); err != nil {
+					return count, err
+				}
+				connUnacked = 0
+			}
+			streamUnacked += int64(frame.Length)
+			if streamUnacked >= int64(config.StreamWindow)/2 {
+				if err := framer.WriteWindowUpdate(streamID, uint32(streamUnacked)); err != nil {
+					return count, err
+				}
+				streamUnacked = 0
+			}
+		case *http2.GoAwayFrame:
+			return count, fmt.Errorf("goh2raw: received GOAWAY: %s", frame.ErrCode)
+		case *http2.MetaHeadersFrame:
+			if !gotHeaders {
+				if status := frame.PseudoValue("status"); status != "200" {
+					return count, fmt.Errorf("goh2raw: unexpected status: %q", status)
+				}
+				gotHeaders = true
+			} else {
+				trailer := http.Header{}
+				for _, field := range frame.RegularFields() {
+					trailer.Add(field.Name, field.Value)
+				}
+				result.Server, _ = bench.ParseTrailer(trailer)
+			}
+			if frame.StreamEnded() {
+				return count, nil
+			}
+		case *http2.PingFrame:
+			if !frame.IsAck() {
+				if err := framer.WritePing(true, frame.Data); err != nil {
+					return count, err
+				}
+			}
+		case *http2.RSTStreamFrame:
+			return count, http2.StreamError{StreamID: frame.StreamID, Code: frame.ErrCode}
+		case *http2.SettingsFrame:
+			if !frame.IsAck() {
+				if err := framer.WriteSettingsAck(); err != nil {
+					return count, err
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
+	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+)
+
+func measureMain(ctx context.Context, args []string) error {
+	defaults := bench.DefaultClientH2Config() // like gohttp2c
+	var (
+		addressFlag      = "127.0.0.1"
+		bytesFlag        = int64(1 << 34)
+		connWindowFlag   = int64(defaults.ConnWindow)
+		durationFlag     = time.Duration(0)
+		intervalFlag     = slogging.DefaultInterval
+		maxFrameSizeFlag = int64(defaults.MaxFrameSize)
+		outputFlag       = ""
+		portFlag         = "4443"
+		repeatFlag       = 1
+		streamWindowFlag = int64(defaults.StreamWindow)
+		warmupFlag       = 0
+	)
+
+	fset := vflag.NewFlagSet("goh2raw measure", vflag.ExitOnError)
+	fset.StringVar(&addressFlag, 'A', "address", "Use the given IP `ADDRESS`.")
+	fset.Int64Var(&bytesFlag, 'n', "bytes", "Number of bytes to transfer.")
+	fset.Int64Var(&connWindowFlag, 0, "conn-window", "Use a connection receive window of `BYTES`.")
+	fset.DurationVar(&durationFlag, 'd', "duration", "Transfer for `DURATION`, up to 1m, instead of a number of bytes.")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.DurationVar(&intervalFlag, 'i', "interval", "Collect a throughput sample every `INTERVAL`.")
+	fset.Int64Var(&maxFrameSizeFlag, 0, "max-frame-size", "Accept DATA frames up to `BYTES`.")
+	fset.StringVar(&outputFlag, 0, "output", "Write JSON results to `FILE`.")
+	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.Int64Var(&streamWindowFlag, 0, "stream-window", "Use a stream receive window of `BYTES`.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	runtimex.Assert(connWindowFlag >= initialWindowSize && connWindowFlag <= 1<<31-1)
+	runtimex.Assert(maxFrameSizeFlag >= initialMaxFrameSize && maxFrameSizeFlag <= maxFrameSize)
+	runtimex.Assert(streamWindowFlag >= 1 && streamWindowFlag <= 1<<31-1)
+	runtimex.Assert(repeatFlag >= 1 && warmupFlag >= 0)
+	runtimex.Assert(durationFlag <= bench.MaxDuration)
+
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
+
+	link := runtimex.LogFatalOnError1(emulation.Config())
+
+	config := &clientConfig{
+		Bytes:        bytesFlag,
+		ConnWindow:   uint32(connWindowFlag),
+		Duration:     durationFlag,
+		Host:         net.JoinHostPort(addressFlag, portFlag),
+		Interval:     intervalFlag,
+		Link:         link,
+		MaxFrameSize: uint32(maxFrameSizeFlag),
+		StreamWindow: uint32(streamWindowFlag),
+	}
+	results := bench.Repeat(warmupFlag, repeatFlag, func() *bench.Result {
+		return runClient(ctx, config)
+	})
+	result := results[len(results)-1]
+	if outputFlag != "" {
+		runtimex.LogFatalOnError0(bench.NewReport("goh2raw", args, results...).WriteFile(outputFlag))
+	}
+	stopProfiling() // LogFatalOnError0 does not run the deferred calls
+	runtimex.LogFatalOnError0(result.Err)
+
+	return nil
+}
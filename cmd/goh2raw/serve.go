@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+)
+
+func serveMain(ctx context.Context, args []string) error {
+	var (
+		addressFlag = "127.0.0.1"
+		portFlag    = "4443"
+	)
+
+	fset := vflag.NewFlagSet("goh2raw serve", vflag.ExitOnError)
+	fset.StringVar(&addressFlag, 'A', "address", "Use the given IP `ADDRESS`.")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
+
+	link := runtimex.LogFatalOnError1(emulation.Config())
+
+	endpoint := net.JoinHostPort(addressFlag, portFlag)
+	listener := link.Listener(runtimex.LogFatalOnError1(net.Listen("tcp", endpoint)))
+
+	go func() {
+		defer listener.Close()
+		<-ctx.Done()
+	}()
+
+	slog.Info("serving raw h2c at", slog.String("addr", endpoint))
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			slog.Info("interrupted", slog.Any("err", err))
+			return nil
+		}
+		go serveConn(conn)
+	}
+}
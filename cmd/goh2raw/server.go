@@ -0,0 +1,336 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/cpuusage"
+	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/2026-02-http2-perf/internal/tcpinfo"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Protocol defaults from RFC 9113.
+const (
+	initialMaxFrameSize = 1 << 14
+	initialWindowSize   = 65535
+	maxFrameSize        = 1<<24 - 1
+)
+
+// payload is the buffer from which we send DATA frames.
+var payload = make([]byte, maxFrameSize)
+
+// serverConn is the server side of a raw HTTP/2 connection.
+//
+// The reader goroutine handles the frames sent by the client, while each
+// stream has its own goroutine writing DATA frames as fast as the flow
+// control windows permit.
+type serverConn struct {
+	// cond is signaled when the windows or the settings change.
+	cond *sync.Cond
+
+	// conn is the underlying connection.
+	conn net.Conn
+
+	// connWindow is the connection-level send window.
+	connWindow int64
+
+	// done indicates that the connection is closed.
+	done bool
+
+	// encbuf is the buffer used by encoder.
+	encbuf *bytes.Buffer
+
+	// encoder is the HPACK encoder.
+	encoder *hpack.Encoder
+
+	// framer reads and writes frames.
+	framer *http2.Framer
+
+	// initialWindow is the peer's SETTINGS_INITIAL_WINDOW_SIZE.
+	initialWindow int64
+
+	// maxFrameSize is the peer's SETTINGS_MAX_FRAME_SIZE.
+	maxFrameSize int64
+
+	// mu protects the windows, the settings, and done.
+	mu sync.Mutex
+
+	// streams maps open stream IDs to their send window.
+	streams map[uint32]*int64
+
+	// wg tracks the stream goroutines.
+	wg sync.WaitGroup
+
+	// wmu serializes writing frames.
+	wmu sync.Mutex
+}
+
+// serveConn serves the given connection until the client closes it.
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+	slog.Info("accepted", slog.String("remoteAddr", conn.RemoteAddr().String()))
+	sampler := tcpinfo.Start(conn, slogging.DefaultInterval)
+	defer sampler.Stop()
+
+	encbuf := &bytes.Buffer{}
+	framer := http2.NewFramer(conn, bufio.NewReader(conn))
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	sc := &serverConn{
+		conn:          conn,
+		connWindow:    initialWindowSize,
+		encbuf:        encbuf,
+		encoder:       hpack.NewEncoder(encbuf),
+		framer:        framer,
+		initialWindow: initialWindowSize,
+		maxFrameSize:  initialMaxFrameSize,
+		streams:       map[uint32]*int64{},
+	}
+	sc.cond = sync.NewCond(&sc.mu)
+
+	err := sc.serve()
+	sc.mu.Lock()
+	sc.done = true
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+	sc.wg.Wait()
+	slog.Info("closed", slog.String("remoteAddr", conn.RemoteAddr().String()), slog.Any("err", err))
+}
+
+// serve reads and handles frames until the client closes the connection.
+func (sc *serverConn) serve() error {
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(sc.conn, preface); err != nil {
+		return err
+	}
+	if string(preface) != http2.ClientPreface {
+		return errors.New("goh2raw: invalid client preface")
+	}
+	if err := sc.write(func() error { return sc.framer.WriteSettings() }); err != nil {
+		return err
+	}
+
+	for {
+		frame, err := sc.framer.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch frame := frame.(type) {
+		case *http2.GoAwayFrame:
+			return nil
+		case *http2.MetaHeadersFrame:
+			err = sc.handleHeaders(frame)
+		case *http2.PingFrame:
+			if !frame.IsAck() {
+				err = sc.write(func() error { return sc.framer.WritePing(true, frame.Data) })
+			}
+		case *http2.RSTStreamFrame:
+			sc.closeStream(frame.StreamID)
+		case *http2.SettingsFrame:
+			err = sc.handleSettings(frame)
+		case *http2.WindowUpdateFrame:
+			sc.handleWindowUpdate(frame)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handleHeaders starts serving a new request.
+func (sc *serverConn) handleHeaders(frame *http2.MetaHeadersFrame) error {
+	method, path := frame.PseudoValue("method"), frame.PseudoValue("path")
+	count, duration, err := parseRequest(method, path)
+	if err != nil {
+		slog.Info("bad request", slog.String("method", method), slog.String("path", path), slog.Any("err", err))
+		return sc.writeHeaders(frame.StreamID, true, hpack.HeaderField{Name: ":status", Value: "400"})
+	}
+	slog.Info(method, slog.String("path", path), slog.Uint64("streamID", uint64(frame.StreamID)))
+
+	sc.mu.Lock()
+	window := sc.initialWindow
+	sc.streams[frame.StreamID] = &window
+	sc.mu.Unlock()
+
+	sc.wg.Go(func() {
+		sc.sendStream(frame.StreamID, count, duration)
+	})
+	return nil
+}
+
+// handleSettings applies and acknowledges the client settings.
+func (sc *serverConn) handleSettings(frame *http2.SettingsFrame) error {
+	if frame.IsAck() {
+		return nil
+	}
+	sc.mu.Lock()
+	frame.ForeachSetting(func(setting http2.Setting) error {
+		switch setting.ID {
+		case http2.SettingInitialWindowSize:
+			delta := int64(setting.Val) - sc.initialWindow
+			for _, window := range sc.streams {
+				*window += delta
+			}
+			sc.initialWindow = int64(setting.Val)
+		case http2.SettingMaxFrameSize:
+			sc.maxFrameSize = int64(setting.Val)
+		}
+		return nil
+	})
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+
+	return sc.write(func() error { return sc.framer.WriteSettingsAck() })
+}
+
+// handleWindowUpdate increments the corresponding send window.
+func (sc *serverConn) handleWindowUpdate(frame *http2.WindowUpdateFrame) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if frame.StreamID == 0 {
+		sc.connWindow += int64(frame.Increment)
+	} else if window, ok := sc.streams[frame.StreamID]; ok {
+		*window += int64(frame.Increment)
+	}
+	sc.cond.Broadcast()
+}
+
+// closeStream forgets about the given stream.
+func (sc *serverConn) closeStream(streamID uint32) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	delete(sc.streams, streamID)
+	sc.cond.Broadcast()
+}
+
+// sendStream sends count bytes, or sends for duration when positive, and
+// then sends the server-side measurements as trailers.
+func (sc *serverConn) sendStream(streamID uint32, count int64, duration time.Duration) {
+	defer sc.closeStream(streamID)
+
+	meter := cpuusage.Start()
+	t0 := time.Now()
+	var deadline time.Time
+	if duration > 0 {
+		deadline, count = t0.Add(duration), math.MaxInt64
+	}
+
+	var (
+		sent      int64
+		writeTime time.Duration
+	)
+	err := sc.writeHeaders(streamID, false, hpack.HeaderField{Name: ":status", Value: "200"})
+	for err == nil && sent < count && (deadline.IsZero() || time.Now().Before(deadline)) {
+		n, ok := sc.reserve(streamID, count-sent)
+		if !ok {
+			err = errors.New("goh2raw: stream closed")
+			break
+		}
+		t := time.Now()
+		err = sc.write(func() error { return sc.framer.WriteData(streamID, false, payload[:n]) })
+		writeTime += time.Since(t)
+		sent += n
+	}
+	elapsed := time.Since(t0)
+	usage := meter.Stop()
+	if err == nil {
+		fields := []hpack.HeaderField{
+			{Name: strings.ToLower(bench.TrailerBytes), Value: strconv.FormatInt(sent, 10)},
+			{Name: strings.ToLower(bench.TrailerElapsed), Value: strconv.FormatInt(int64(elapsed), 10)},
+			{Name: strings.ToLower(bench.TrailerWriteTime), Value: strconv.FormatInt(int64(writeTime), 10)},
+		}
+		for key, value := range bench.CPUTrailers(usage) {
+			fields = append(fields, hpack.HeaderField{Name: strings.ToLower(key), Value: value})
+		}
+		err = sc.writeHeaders(streamID, true, fields...)
+	}
+	(&bench.Result{Bytes: sent, Elapsed: elapsed, Err: err}).Log("server")
+	usage.Log("cpu", sent)
+}
+
+// reserve waits for the windows to allow sending and reserves up to
+// count bytes for the given stream. It returns false if the stream or
+// the connection have been closed.
+func (sc *serverConn) reserve(streamID uint32, count int64) (int64, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for {
+		window, ok := sc.streams[streamID]
+		if sc.done || !ok {
+			return 0, false
+		}
+		if sc.connWindow > 0 && *window > 0 {
+			n := min(count, sc.connWindow, *window, sc.maxFrameSize)
+			sc.connWindow -= n
+			*window -= n
+			return n, true
+		}
+		sc.cond.Wait()
+	}
+}
+
+// write calls fn while holding the write lock.
+func (sc *serverConn) write(fn func() error) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	return fn()
+}
+
+// writeHeaders writes a HEADERS frame containing the given fields.
+func (sc *serverConn) writeHeaders(streamID uint32, endStream bool, fields ...hpack.HeaderField) error {
+	return sc.write(func() error {
+		sc.encbuf.Reset()
+		for _, field := range fields {
+			if err := sc.encoder.WriteField(field); err != nil {
+				return err
+			}
+		}
+		return sc.framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      streamID,
+			BlockFragment: sc.encbuf.Bytes(),
+			EndStream:     endStream,
+			EndHeaders:    true,
+		})
+	})
+}
+
+// parseRequest parses GET /{size} and GET /time/{duration} requests.
+func parseRequest(method, path string) (int64, time.Duration, error) {
+	if method != "GET" {
+		return 0, 0, errors.New("goh2raw: unsupported method")
+	}
+	if value, ok := strings.CutPrefix(path, "/time/"); ok {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, 0, err
+		}
+		if duration <= 0 || duration > bench.MaxDuration {
+			return 0, 0, errors.New("goh2raw: duration out of range")
+		}
+		return 0, duration, nil
+	}
+	count, err := strconv.ParseInt(strings.TrimPrefix(path, "/"), 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	if count < 0 {
+		return 0, 0, errors.New("goh2raw: negative size")
+	}
+	return count, 0, nil
+}
@@ -4,14 +4,13 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"io"
-	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
+	"time"
 
-	"github.com/bassosimone/2026-02-http2-perf/internal/infinite"
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
 	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -19,45 +18,75 @@ import (
 
 func measureMain(ctx context.Context, args []string) error {
 	var (
-		addressFlag = "127.0.0.1"
-		bytesFlag   = int64(1 << 34)
-		methodFlag  = "GET"
-		portFlag    = "8080"
+		addressFlag       = "127.0.0.1"
+		bytesFlag         = int64(1 << 34)
+		connectionsFlag   = 1
+		durationFlag      = time.Duration(0)
+		intervalFlag      = slogging.DefaultInterval
+		methodFlag        = "GET"
+		outputFlag        = ""
+		portFlag          = "8080"
+		probeIntervalFlag = time.Duration(0)
+		repeatFlag        = 1
+		trailersFlag      = false
+		warmupFlag        = 0
 	)
 
 	fset := vflag.NewFlagSet("gohttp1 measure", vflag.ExitOnError)
 	fset.StringVar(&addressFlag, 'A', "addresss", "Use the given IP `ADDRESS`.")
 	fset.Int64Var(&bytesFlag, 'n', "bytes", "Number of bytes to transfer.")
+	fset.IntVar(&connectionsFlag, 'C', "connections", "Use `N` parallel TCP connections.")
+	fset.DurationVar(&durationFlag, 'd', "duration", "Transfer for `DURATION`, up to 1m, instead of a number of bytes.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.DurationVar(&intervalFlag, 'i', "interval", "Collect a throughput sample every `INTERVAL`.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (PUT, GET).")
+	fset.StringVar(&outputFlag, 0, "output", "Write JSON results to `FILE`.")
 	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.DurationVar(&probeIntervalFlag, 0, "probe-interval", "Send responsiveness probes every `INTERVAL`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.BoolVar(&trailersFlag, 0, "trailers", "Ask the server for its measurements as trailers, using chunked encoding with HTTP/1.1 GET.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
 	runtimex.PanicOnError0(fset.Parse(args))
 
 	runtimex.Assert(methodFlag == "GET" || methodFlag == "PUT")
-	URL := &url.URL{
-		Scheme: "http",
-		Host:   net.JoinHostPort(addressFlag, portFlag),
-		Path:   fmt.Sprintf("/%d", bytesFlag),
-	}
-	var body io.Reader = http.NoBody
-	if methodFlag == "PUT" {
-		runtimex.Assert(bytesFlag >= 1)
-		body = io.LimitReader(infinite.Reader{}, bytesFlag)
-	}
+	runtimex.Assert(repeatFlag >= 1 && warmupFlag >= 0)
+	runtimex.Assert(connectionsFlag >= 1)
+	runtimex.Assert(durationFlag <= bench.MaxDuration)
 
-	req := runtimex.LogFatalOnError1(http.NewRequestWithContext(ctx, methodFlag, URL.String(), body))
-	if methodFlag == "PUT" {
-		req.ContentLength = bytesFlag
-	}
-	slog.Info("request", slog.String("method", methodFlag), slog.String("URL", URL.String()))
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
 
-	resp := runtimex.LogFatalOnError1(http.DefaultClient.Do(req))
-	bodyWrapper := slogging.NewReadCloser(resp.Body)
-	defer bodyWrapper.Close()
-	slog.Info("response", slog.Int("status", resp.StatusCode))
+	link := runtimex.LogFatalOnError1(emulation.Config())
 
-	buf := make([]byte, 1<<20) // 1 MiB
-	_ = runtimex.LogFatalOnError1(io.CopyBuffer(io.Discard, bodyWrapper, buf))
+	config := &bench.Config{
+		Bytes:       bytesFlag,
+		Connections: connectionsFlag,
+		Duration:    durationFlag,
+		Host:        net.JoinHostPort(addressFlag, portFlag),
+		Interval:    intervalFlag,
+		Method:      methodFlag,
+		NewTransport: func() http.RoundTripper {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.DialContext = link.DialContext(transport.DialContext)
+			return transport
+		},
+		ProbeInterval: probeIntervalFlag,
+		Scheme:        "http",
+		Trailers:      trailersFlag,
+	}
+	results := bench.Repeat(warmupFlag, repeatFlag, func() *bench.Result {
+		return bench.Run(ctx, config)
+	})
+	result := results[len(results)-1]
+	if outputFlag != "" {
+		runtimex.LogFatalOnError0(bench.NewReport("gohttp1", args, results...).WriteFile(outputFlag))
+	}
+	stopProfiling() // LogFatalOnError0 does not run the deferred calls
+	runtimex.LogFatalOnError0(result.Err)
 
 	return nil
 }
@@ -7,14 +7,15 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
 	"os"
+	"time"
 
-	"github.com/bassosimone/2026-02-http2-perf/internal/infinite"
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
 	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -22,83 +23,162 @@ import (
 )
 
 func measureMain(ctx context.Context, args []string) error {
+	defaults := bench.DefaultClientH2Config()
 	var (
-		addressFlag = "127.0.0.1"
-		bytesFlag   = int64(1 << 34)
-		certFlag    = "cert.pem"
-		http2Flag   = false
-		methodFlag  = "GET"
-		portFlag    = "4443"
+		addressFlag       = "127.0.0.1"
+		bytesFlag         = int64(1 << 34)
+		connectionsFlag   = 1
+		connWindowFlag    = defaults.ConnWindow
+		durationFlag      = time.Duration(0)
+		intervalFlag      = slogging.DefaultInterval
+		certFlag          = "cert.pem"
+		http2Flag         = false
+		maxFrameSizeFlag  = defaults.MaxFrameSize
+		methodFlag        = "GET"
+		outputFlag        = ""
+		portFlag          = "4443"
+		probeIntervalFlag = time.Duration(0)
+		readBufferFlag    = 0
+		repeatFlag        = 1
+		streamsFlag       = 1
+		streamWindowFlag  = defaults.StreamWindow
+		trailersFlag      = false
+		warmupFlag        = 0
+		writeBufferFlag   = 0
 	)
 
 	fset := vflag.NewFlagSet("gohttp2 measure", vflag.ExitOnError)
 	fset.StringVar(&addressFlag, 'A', "addresss", "Use the given IP `ADDRESS`.")
 	fset.Int64Var(&bytesFlag, 'n', "bytes", "Number of bytes to transfer.")
+	fset.IntVar(&connectionsFlag, 'C', "connections", "Use `N` parallel TCP connections.")
+	fset.Int32Var(&connWindowFlag, 0, "conn-window", "Use an HTTP/2 connection receive window of `BYTES`.")
+	fset.DurationVar(&durationFlag, 'd', "duration", "Transfer for `DURATION`, up to 1m, instead of a number of bytes.")
 	fset.StringVar(&certFlag, 0, "cert", "Use `FILE` as the CA certificate.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.DurationVar(&intervalFlag, 'i', "interval", "Collect a throughput sample every `INTERVAL`.")
 	fset.BoolVar(&http2Flag, '2', "http2", "Force HTTP/2 (default is HTTP/1.1).")
+	fset.Uint32Var(&maxFrameSizeFlag, 0, "max-frame-size", "Accept HTTP/2 frames up to `BYTES`.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (PUT, GET).")
+	fset.StringVar(&outputFlag, 0, "output", "Write JSON results to `FILE`.")
 	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.DurationVar(&probeIntervalFlag, 0, "probe-interval", "Send responsiveness probes every `INTERVAL`.")
+	fset.IntVar(&readBufferFlag, 0, "read-buffer", "Set the socket receive buffer to `BYTES`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.IntVar(&streamsFlag, 'P', "streams", "Use `N` concurrent streams over a single connection.")
+	fset.Int32Var(&streamWindowFlag, 0, "stream-window", "Use an HTTP/2 stream receive window of `BYTES`.")
+	fset.BoolVar(&trailersFlag, 0, "trailers", "Ask the server for its measurements as trailers, using chunked encoding with HTTP/1.1 GET.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	fset.IntVar(&writeBufferFlag, 0, "write-buffer", "Set the socket send buffer to `BYTES`.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
 	runtimex.PanicOnError0(fset.Parse(args))
 
 	runtimex.Assert(methodFlag == "GET" || methodFlag == "PUT")
+	runtimex.Assert(repeatFlag >= 1 && warmupFlag >= 0)
+	runtimex.Assert(connectionsFlag >= 1)
+	runtimex.Assert(durationFlag <= bench.MaxDuration)
+	runtimex.Assert(streamsFlag >= 1)
+	runtimex.Assert(maxFrameSizeFlag >= 1<<14 && maxFrameSizeFlag <= 1<<24-1)
+	runtimex.Assert(streamsFlag == 1 || http2Flag) // HTTP/1.1 cannot multiplex streams
 	runtimex.Assert(certFlag != "")
 
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
+
+	link := runtimex.LogFatalOnError1(emulation.Config())
+
 	// Load the CA certificate to trust the server's self-signed cert.
 	caCert := runtimex.LogFatalOnError1(os.ReadFile(certFlag))
 	caPool := x509.NewCertPool()
 	runtimex.Assert(caPool.AppendCertsFromPEM(caCert))
 
-	tlsConfig := &tls.Config{
-		RootCAs: caPool,
+	h2config := &bench.H2Config{
+		ConnWindow:   connWindowFlag,
+		MaxFrameSize: maxFrameSizeFlag,
+		ReadBuffer:   readBufferFlag,
+		StreamWindow: streamWindowFlag,
+		WriteBuffer:  writeBufferFlag,
 	}
-	if !http2Flag {
-		// Disable HTTP/2 by setting NextProtos to only http/1.1.
-		tlsConfig.NextProtos = []string{"http/1.1"}
+	if http2Flag {
+		h2config.Log()
+	} else {
+		// HTTP/1.1 only uses the socket buffer sizes.
+		slog.Info("buffers", slog.Int("readBuffer", readBufferFlag), slog.Int("writeBuffer", writeBufferFlag))
 	}
 
-	transport := &http.Transport{
-		TLSClientConfig:   tlsConfig,
-		ForceAttemptHTTP2: http2Flag,
-	}
-	if http2Flag {
-		// Tune HTTP/2 for maximum throughput.
-		h2transport, err := http2.ConfigureTransports(transport)
-		if err == nil {
-			h2transport.ReadIdleTimeout = 0
-			h2transport.StrictMaxConcurrentStreams = false
+	host := net.JoinHostPort(addressFlag, portFlag)
+	newTransport := func() http.RoundTripper {
+		if !http2Flag {
+			// Disable HTTP/2 by setting NextProtos to only http/1.1.
+			return &http.Transport{
+				DialContext: link.DialContext(func(ctx context.Context, network, address string) (net.Conn, error) {
+					return h2config.DialContext(ctx, address)
+				}),
+				TLSClientConfig: &tls.Config{
+					NextProtos: []string{"http/1.1"},
+					RootCAs:    caPool,
+				},
+			}
 		}
-	}
-	client := &http.Client{Transport: transport}
 
-	URL := &url.URL{
-		Scheme: "https",
-		Host:   net.JoinHostPort(addressFlag, portFlag),
-		Path:   fmt.Sprintf("/%d", bytesFlag),
-	}
-	var body io.Reader = http.NoBody
-	if methodFlag == "PUT" {
-		runtimex.Assert(bytesFlag >= 1)
-		body = io.LimitReader(infinite.Reader{}, bytesFlag)
+		// Use a single HTTP/2 connection tuned for maximum throughput.
+		tlsConfig := &tls.Config{
+			NextProtos: []string{http2.NextProtoTLS},
+			RootCAs:    caPool,
+			ServerName: addressFlag,
+		}
+		h2transport := h2config.NewTransport()
+		h2transport.ReadIdleTimeout = 0
+		h2transport.StrictMaxConcurrentStreams = false
+		h2transport.TLSClientConfig = tlsConfig
+		return bench.NewH2Transport(h2transport, func(ctx context.Context) (net.Conn, error) {
+			return dialH2(ctx, h2config, link, host, tlsConfig)
+		})
 	}
 
-	req := runtimex.LogFatalOnError1(http.NewRequestWithContext(ctx, methodFlag, URL.String(), body))
-	if methodFlag == "PUT" {
-		req.ContentLength = bytesFlag
+	config := &bench.Config{
+		Bytes:         bytesFlag,
+		Connections:   connectionsFlag,
+		Duration:      durationFlag,
+		Host:          host,
+		Interval:      intervalFlag,
+		Method:        methodFlag,
+		NewTransport:  newTransport,
+		ProbeInterval: probeIntervalFlag,
+		Scheme:        "https",
+		Streams:       streamsFlag,
+		Trailers:      trailersFlag,
 	}
-	slog.Info("request", slog.String("method", methodFlag), slog.String("URL", URL.String()))
-
-	resp := runtimex.LogFatalOnError1(client.Do(req))
-	bodyWrapper := slogging.NewReadCloser(resp.Body)
-	defer bodyWrapper.Close()
-	slog.Info("response",
-		slog.Int("status", resp.StatusCode),
-		slog.String("proto", resp.Proto),
-		slog.String("alpn", resp.TLS.NegotiatedProtocol),
-	)
-
-	buf := make([]byte, 1<<20) // 1 MiB
-	_ = runtimex.LogFatalOnError1(io.CopyBuffer(io.Discard, bodyWrapper, buf))
+	results := bench.Repeat(warmupFlag, repeatFlag, func() *bench.Result {
+		return bench.Run(ctx, config)
+	})
+	result := results[len(results)-1]
+	if outputFlag != "" {
+		runtimex.LogFatalOnError0(bench.NewReport("gohttp2", args, results...).WriteFile(outputFlag))
+	}
+	stopProfiling() // LogFatalOnError0 does not run the deferred calls
+	runtimex.LogFatalOnError0(result.Err)
 
 	return nil
 }
+
+// dialH2 dials a TLS connection and ensures the server negotiated HTTP/2.
+func dialH2(ctx context.Context, h2config *bench.H2Config, link *linkemu.Config, host string, tlsConfig *tls.Config) (net.Conn, error) {
+	tcpConn, err := h2config.DialContext(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	tcpConn = link.Conn(tcpConn)
+	conn := tls.Client(tcpConn, tlsConfig)
+	if err := conn.HandshakeContext(ctx); err != nil {
+		tcpConn.Close()
+		return nil, err
+	}
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != http2.NextProtoTLS {
+		conn.Close()
+		return nil, fmt.Errorf("server negotiated %q instead of %q", proto, http2.NextProtoTLS)
+	}
+	return conn, nil
+}
@@ -5,48 +5,79 @@ package main
 import (
 	"context"
 	"errors"
-	"io"
 	"log/slog"
 	"net"
 	"net/http"
-	"strconv"
 
-	"github.com/bassosimone/2026-02-http2-perf/internal/infinite"
-	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
 	"golang.org/x/net/http2"
 )
 
 func serveMain(ctx context.Context, args []string) error {
+	defaults := bench.DefaultServerH2Config()
 	var (
-		addressFlag = "127.0.0.1"
-		certFlag    = "cert.pem"
-		keyFlag     = "key.pem"
-		portFlag    = "4443"
+		addressFlag              = "127.0.0.1"
+		certFlag                 = "cert.pem"
+		connWindowFlag           = defaults.ConnWindow
+		keyFlag                  = "key.pem"
+		maxConcurrentStreamsFlag = uint32(0)
+		maxFrameSizeFlag         = defaults.MaxFrameSize
+		portFlag                 = "4443"
+		readBufferFlag           = 0
+		streamWindowFlag         = defaults.StreamWindow
+		writeBufferFlag          = 0
 	)
 
 	fset := vflag.NewFlagSet("gohttp2 serve", vflag.ExitOnError)
 	fset.StringVar(&addressFlag, 'A', "addresss", "Use the given IP `ADDRESS`.")
 	fset.StringVar(&certFlag, 0, "cert", "Use `FILE` as the TLS certificate.")
+	fset.Int32Var(&connWindowFlag, 0, "conn-window", "Use an HTTP/2 connection receive window of `BYTES`.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&keyFlag, 0, "key", "Use `FILE` as the TLS private key.")
+	fset.Uint32Var(&maxConcurrentStreamsFlag, 0, "max-concurrent-streams", "Allow up to `N` concurrent streams per connection.")
+	fset.Uint32Var(&maxFrameSizeFlag, 0, "max-frame-size", "Accept HTTP/2 frames up to `BYTES`.")
 	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.IntVar(&readBufferFlag, 0, "read-buffer", "Set the socket receive buffer to `BYTES`.")
+	fset.Int32Var(&streamWindowFlag, 0, "stream-window", "Use an HTTP/2 stream receive window of `BYTES`.")
+	fset.IntVar(&writeBufferFlag, 0, "write-buffer", "Set the socket send buffer to `BYTES`.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
 	runtimex.PanicOnError0(fset.Parse(args))
 
-	mux := http.NewServeMux()
-	mux.Handle("GET /{size}", http.HandlerFunc(serveHandleGet))
-	mux.Handle("PUT /{size}", http.HandlerFunc(serveHandlePut))
+	runtimex.Assert(maxFrameSizeFlag >= 1<<14 && maxFrameSizeFlag <= 1<<24-1)
+
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
+
+	link := runtimex.LogFatalOnError1(emulation.Config())
+
+	handler := bench.NewHandler()
+
+	h2config := &bench.H2Config{
+		ConnWindow:           connWindowFlag,
+		MaxConcurrentStreams: maxConcurrentStreamsFlag,
+		MaxFrameSize:         maxFrameSizeFlag,
+		ReadBuffer:           readBufferFlag,
+		StreamWindow:         streamWindowFlag,
+		WriteBuffer:          writeBufferFlag,
+	}
+	h2config.Log()
 
 	endpoint := net.JoinHostPort(addressFlag, portFlag)
-	srv := &http.Server{Addr: endpoint, Handler: mux}
+	srv := &http.Server{
+		Addr:        endpoint,
+		ConnContext: h2config.ConnContext,
+		Handler:     handler,
+	}
 
 	// Tune HTTP/2 for maximum throughput.
-	http2.ConfigureServer(srv, &http2.Server{
-		MaxReadFrameSize:             (1 << 24) - 1, // ~16 MiB (protocol max)
-		MaxUploadBufferPerConnection: 1 << 30,       // 1 GiB
-		MaxUploadBufferPerStream:     1 << 30,       // 1 GiB
-	})
+	http2.ConfigureServer(srv, h2config.NewServer())
 
 	go func() {
 		defer srv.Close()
@@ -54,7 +85,8 @@ func serveMain(ctx context.Context, args []string) error {
 	}()
 
 	slog.Info("serving at", slog.String("addr", endpoint))
-	err := srv.ListenAndServeTLS(certFlag, keyFlag)
+	listener := runtimex.LogFatalOnError1(net.Listen("tcp", endpoint))
+	err := srv.ServeTLS(link.Listener(listener), certFlag, keyFlag)
 	slog.Info("interrupted", slog.Any("err", err))
 
 	if errors.Is(err, http.ErrServerClosed) {
@@ -63,38 +95,3 @@ func serveMain(ctx context.Context, args []string) error {
 	runtimex.LogFatalOnError0(err)
 	return nil
 }
-
-func serveHandleGet(rw http.ResponseWriter, req *http.Request) {
-	count, err := strconv.ParseInt(req.PathValue("size"), 10, 64)
-	if err != nil || count < 0 {
-		rw.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	slog.Info("GET", slog.Int64("count", count),
-		slog.String("proto", req.Proto),
-		slog.String("alpn", req.TLS.NegotiatedProtocol),
-	)
-	bodyReader := io.LimitReader(infinite.Reader{}, count)
-	rw.Header().Set("Content-Length", strconv.FormatInt(count, 10))
-	rw.WriteHeader(http.StatusOK)
-	buf := make([]byte, 1<<20) // 1 MiB
-	io.CopyBuffer(rw, bodyReader, buf)
-}
-
-func serveHandlePut(rw http.ResponseWriter, req *http.Request) {
-	expectCount, err := strconv.ParseInt(req.PathValue("size"), 10, 64)
-	if err != nil || expectCount < 0 {
-		rw.WriteHeader(http.StatusBadRequest)
-		return
-	}
-	slog.Info("PUT", slog.Int64("expectCount", expectCount),
-		slog.String("proto", req.Proto),
-		slog.String("alpn", req.TLS.NegotiatedProtocol),
-	)
-	bodyWrapper := slogging.NewReadCloser(req.Body)
-	defer bodyWrapper.Close()
-	bodyReader := io.LimitReader(bodyWrapper, expectCount)
-	buf := make([]byte, 1<<20) // 1 MiB
-	io.CopyBuffer(io.Discard, bodyReader, buf)
-	rw.WriteHeader(http.StatusNoContent)
-}
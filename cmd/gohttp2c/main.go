@@ -15,6 +15,7 @@ func main() {
 
 	disp.AddCommand("measure", vclip.CommandFunc(measureMain), "Measure performance.")
 	disp.AddCommand("serve", vclip.CommandFunc(serveMain), "Serve requests.")
+	disp.AddCommand("serve-mw", vclip.CommandFunc(serveMWMain), "Serve requests using the experimental multi-writer server.")
 
 	vclip.Main(context.Background(), disp, os.Args[1:])
 }
@@ -4,74 +4,121 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
-	"fmt"
-	"io"
-	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
+	"time"
 
-	"github.com/bassosimone/2026-02-http2-perf/internal/infinite"
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
 	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
-	"golang.org/x/net/http2"
 )
 
 func measureMain(ctx context.Context, args []string) error {
+	defaults := bench.DefaultClientH2Config()
 	var (
-		addressFlag = "127.0.0.1"
-		bytesFlag   = int64(1 << 34)
-		methodFlag  = "GET"
-		portFlag    = "4443"
+		addressFlag       = "127.0.0.1"
+		bytesFlag         = int64(1 << 34)
+		connectionsFlag   = 1
+		connWindowFlag    = defaults.ConnWindow
+		durationFlag      = time.Duration(0)
+		intervalFlag      = slogging.DefaultInterval
+		maxFrameSizeFlag  = defaults.MaxFrameSize
+		methodFlag        = "GET"
+		outputFlag        = ""
+		portFlag          = "4443"
+		probeIntervalFlag = time.Duration(0)
+		readBufferFlag    = 0
+		repeatFlag        = 1
+		streamsFlag       = 1
+		streamWindowFlag  = defaults.StreamWindow
+		warmupFlag        = 0
+		writeBufferFlag   = 0
 	)
 
 	fset := vflag.NewFlagSet("gohttp2c measure", vflag.ExitOnError)
 	fset.StringVar(&addressFlag, 'A', "address", "Use the given IP `ADDRESS`.")
 	fset.Int64Var(&bytesFlag, 'n', "bytes", "Number of bytes to transfer.")
+	fset.IntVar(&connectionsFlag, 'C', "connections", "Use `N` parallel TCP connections.")
+	fset.Int32Var(&connWindowFlag, 0, "conn-window", "Use an HTTP/2 connection receive window of `BYTES`.")
+	fset.DurationVar(&durationFlag, 'd', "duration", "Transfer for `DURATION`, up to 1m, instead of a number of bytes.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.DurationVar(&intervalFlag, 'i', "interval", "Collect a throughput sample every `INTERVAL`.")
+	fset.Uint32Var(&maxFrameSizeFlag, 0, "max-frame-size", "Accept HTTP/2 frames up to `BYTES`.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (PUT, GET).")
+	fset.StringVar(&outputFlag, 0, "output", "Write JSON results to `FILE`.")
 	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.DurationVar(&probeIntervalFlag, 0, "probe-interval", "Send responsiveness probes every `INTERVAL`.")
+	fset.IntVar(&readBufferFlag, 0, "read-buffer", "Set the socket receive buffer to `BYTES`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.IntVar(&streamsFlag, 'P', "streams", "Use `N` concurrent streams over a single connection.")
+	fset.Int32Var(&streamWindowFlag, 0, "stream-window", "Use an HTTP/2 stream receive window of `BYTES`.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	fset.IntVar(&writeBufferFlag, 0, "write-buffer", "Set the socket send buffer to `BYTES`.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
 	runtimex.PanicOnError0(fset.Parse(args))
 
 	runtimex.Assert(methodFlag == "GET" || methodFlag == "PUT")
+	runtimex.Assert(repeatFlag >= 1 && warmupFlag >= 0)
+	runtimex.Assert(connectionsFlag >= 1)
+	runtimex.Assert(durationFlag <= bench.MaxDuration)
+	runtimex.Assert(streamsFlag >= 1)
+	runtimex.Assert(maxFrameSizeFlag >= 1<<14 && maxFrameSizeFlag <= 1<<24-1)
 
-	transport := &http2.Transport{
-		AllowHTTP: true,
-		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
-			return (&net.Dialer{}).DialContext(ctx, network, addr)
-		},
-	}
-	client := &http.Client{Transport: transport}
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
 
-	URL := &url.URL{
-		Scheme: "http",
-		Host:   net.JoinHostPort(addressFlag, portFlag),
-		Path:   fmt.Sprintf("/%d", bytesFlag),
-	}
-	var body io.Reader = http.NoBody
-	if methodFlag == "PUT" {
-		runtimex.Assert(bytesFlag >= 1)
-		body = io.LimitReader(infinite.Reader{}, bytesFlag)
-	}
+	link := runtimex.LogFatalOnError1(emulation.Config())
 
-	req := runtimex.LogFatalOnError1(http.NewRequestWithContext(ctx, methodFlag, URL.String(), body))
-	if methodFlag == "PUT" {
-		req.ContentLength = bytesFlag
+	h2config := &bench.H2Config{
+		ConnWindow:   connWindowFlag,
+		MaxFrameSize: maxFrameSizeFlag,
+		ReadBuffer:   readBufferFlag,
+		StreamWindow: streamWindowFlag,
+		WriteBuffer:  writeBufferFlag,
 	}
-	slog.Info("request", slog.String("method", methodFlag), slog.String("URL", URL.String()))
+	h2config.Log()
 
-	resp := runtimex.LogFatalOnError1(client.Do(req))
-	bodyWrapper := slogging.NewReadCloser(resp.Body)
-	defer bodyWrapper.Close()
-	slog.Info("response",
-		slog.Int("status", resp.StatusCode),
-		slog.String("proto", resp.Proto),
-	)
+	host := net.JoinHostPort(addressFlag, portFlag)
+	newTransport := func() http.RoundTripper {
+		// Use a single prior-knowledge cleartext HTTP/2 connection.
+		h2transport := h2config.NewTransport()
+		h2transport.AllowHTTP = true
+		return bench.NewH2Transport(h2transport, func(ctx context.Context) (net.Conn, error) {
+			conn, err := h2config.DialContext(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			return link.Conn(conn), nil
+		})
+	}
 
-	buf := make([]byte, 1<<20) // 1 MiB
-	_ = runtimex.LogFatalOnError1(io.CopyBuffer(io.Discard, bodyWrapper, buf))
+	config := &bench.Config{
+		Bytes:         bytesFlag,
+		Connections:   connectionsFlag,
+		Duration:      durationFlag,
+		Host:          host,
+		Interval:      intervalFlag,
+		Method:        methodFlag,
+		NewTransport:  newTransport,
+		ProbeInterval: probeIntervalFlag,
+		Scheme:        "http",
+		Streams:       streamsFlag,
+	}
+	results := bench.Repeat(warmupFlag, repeatFlag, func() *bench.Result {
+		return bench.Run(ctx, config)
+	})
+	result := results[len(results)-1]
+	if outputFlag != "" {
+		runtimex.LogFatalOnError0(bench.NewReport("gohttp2c", args, results...).WriteFile(outputFlag))
+	}
+	stopProfiling() // LogFatalOnError0 does not run the deferred calls
+	runtimex.LogFatalOnError0(result.Err)
 
 	return nil
 }
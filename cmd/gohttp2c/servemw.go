@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/h2mw"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+)
+
+func serveMWMain(ctx context.Context, args []string) error {
+	defaults := bench.DefaultServerH2Config()
+	var (
+		addressFlag      = "127.0.0.1"
+		batchSizeFlag    = 1 << 20
+		connWindowFlag   = defaults.ConnWindow
+		maxFrameSizeFlag = defaults.MaxFrameSize
+		portFlag         = "4443"
+		readBufferFlag   = 0
+		streamWindowFlag = defaults.StreamWindow
+		writeBufferFlag  = 0
+	)
+
+	fset := vflag.NewFlagSet("gohttp2c serve-mw", vflag.ExitOnError)
+	fset.StringVar(&addressFlag, 'A', "address", "Use the given IP `ADDRESS`.")
+	fset.IntVar(&batchSizeFlag, 0, "batch-size", "Batch frames in a buffer of `BYTES` before writing.")
+	fset.Int32Var(&connWindowFlag, 0, "conn-window", "Use an HTTP/2 connection receive window of `BYTES`.")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.Uint32Var(&maxFrameSizeFlag, 0, "max-frame-size", "Accept HTTP/2 frames up to `BYTES`.")
+	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.IntVar(&readBufferFlag, 0, "read-buffer", "Set the socket receive buffer to `BYTES`.")
+	fset.Int32Var(&streamWindowFlag, 0, "stream-window", "Use an HTTP/2 stream receive window of `BYTES`.")
+	fset.IntVar(&writeBufferFlag, 0, "write-buffer", "Set the socket send buffer to `BYTES`.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	runtimex.Assert(batchSizeFlag > 0)
+	runtimex.Assert(connWindowFlag >= 65535)
+	runtimex.Assert(maxFrameSizeFlag >= 1<<14 && maxFrameSizeFlag <= 1<<24-1)
+	runtimex.Assert(streamWindowFlag >= 1)
+
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
+
+	link := runtimex.LogFatalOnError1(emulation.Config())
+
+	h2config := &bench.H2Config{
+		ConnWindow:   connWindowFlag,
+		MaxFrameSize: maxFrameSizeFlag,
+		ReadBuffer:   readBufferFlag,
+		StreamWindow: streamWindowFlag,
+		WriteBuffer:  writeBufferFlag,
+	}
+	h2config.Log()
+
+	srv := &h2mw.Server{
+		ConnContext:      h2config.ConnContext,
+		ConnWindow:       uint32(connWindowFlag),
+		Handler:          bench.NewHandler(),
+		MaxReadFrameSize: maxFrameSizeFlag,
+		StreamWindow:     uint32(streamWindowFlag),
+		WriteBufferSize:  batchSizeFlag,
+	}
+
+	endpoint := net.JoinHostPort(addressFlag, portFlag)
+	listener := runtimex.LogFatalOnError1(net.Listen("tcp", endpoint))
+
+	go func() {
+		defer listener.Close()
+		<-ctx.Done()
+	}()
+
+	slog.Info("serving h2c using the multi-writer server at", slog.String("addr", endpoint))
+	err := srv.Serve(link.Listener(listener))
+	slog.Info("interrupted", slog.Any("err", err))
+	return nil
+}
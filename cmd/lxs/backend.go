@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// backend creates the client, router, and server nodes of the topology
+// and runs commands and transfers files within them.
+//
+// The commands run with the working directory set to the node's home
+// directory, where [backend.Push] copies files, so they can use relative
+// paths to access pushed files and to write files we later pull.
+type backend interface {
+	// Create creates the topology with the given name.
+	Create(name string)
+
+	// Destroy destroys the topology with the given name, ignoring errors.
+	Destroy(name string)
+
+	// Exec returns the argv running argv inside the given node.
+	Exec(name, node string, argv ...string) []string
+
+	// Kill sends SIGTERM to the processes running program inside the
+	// given node and fails if there are no such processes.
+	Kill(name, node, program string) error
+
+	// Program makes the locally built program available inside the given
+	// node and returns the path to use for running it.
+	Program(name, node, program string) string
+
+	// Pull copies file from the node's home directory to dest.
+	Pull(name, node, file, dest string) error
+
+	// Push copies the local file into the node's home directory.
+	Push(name, node, file string)
+}
+
+// backendFor returns the backend of the topology with the given name, which
+// uses network namespaces if createMain created them and LXC otherwise.
+func backendFor(name string) backend {
+	if _, err := os.Stat(filepath.Join(netnsRunDir, name+"-client")); err == nil {
+		return netnsBackend{}
+	}
+	return lxcBackend{}
+}
+
+// configureTopology assigns the addresses and routes of the topology
+// once the backend has connected the nodes as follows:
+//
+//	client eth1 <-> eth1 router eth2 <-> eth1 server
+func configureTopology(tb backend, name string) {
+	mustRunArgv(tb.Exec(name, "client", "ip", "addr", "add", clientAddr+"/24", "dev", "eth1")...)
+	mustRunArgv(tb.Exec(name, "client", "ip", "link", "set", "eth1", "up")...)
+	mustRunArgv(tb.Exec(name, "client", "ip", "route", "add", "192.168.1.0/24", "via", "192.168.0.1")...)
+
+	mustRunArgv(tb.Exec(name, "router", "ip", "addr", "add", "192.168.0.1/24", "dev", "eth1")...)
+	mustRunArgv(tb.Exec(name, "router", "ip", "link", "set", "eth1", "up")...)
+	mustRunArgv(tb.Exec(name, "router", "ip", "addr", "add", "192.168.1.1/24", "dev", "eth2")...)
+	mustRunArgv(tb.Exec(name, "router", "ip", "link", "set", "eth2", "up")...)
+	mustRunArgv(tb.Exec(name, "router", "sysctl", "net.ipv4.ip_forward=1")...)
+
+	mustRunArgv(tb.Exec(name, "server", "ip", "addr", "add", serverAddr+"/24", "dev", "eth1")...)
+	mustRunArgv(tb.Exec(name, "server", "ip", "link", "set", "eth1", "up")...)
+	mustRunArgv(tb.Exec(name, "server", "ip", "route", "add", "192.168.0.0/24", "via", "192.168.1.1")...)
+}
@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+	"github.com/bassosimone/2026-02-http2-perf/internal/stats"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+)
+
+func compareMain(ctx context.Context, args []string) error {
+	fset := vflag.NewFlagSet("lxs compare", vflag.ExitOnError)
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.SetMinMaxPositionalArgs(2, 2) // the old and new sweep directories
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	oldRows := runtimex.LogFatalOnError1(reportLoad(fset.Args()[0], nil))
+	newRows := runtimex.LogFatalOnError1(reportLoad(fset.Args()[1], nil))
+
+	// Like benchstat, we only report the delta when it is significant
+	// and otherwise print "~" to show there is no detectable change.
+	fmt.Printf("| Stack | Direction | Old | New | Delta | Significance |\n")
+	fmt.Printf("|---|---|---|---|---|---|\n")
+	// We pair the rows with the same label in order of appearance, so that
+	// we can compare sweeps of the same stacks using distinct flags.
+	used := make([]bool, len(newRows))
+	for _, oldRow := range oldRows {
+		idx := -1
+		for jdx, row := range newRows {
+			if !used[jdx] && row.label == oldRow.label {
+				idx = jdx
+				break
+			}
+		}
+		if idx < 0 {
+			continue
+		}
+		used[idx] = true
+		newRow := newRows[idx]
+		label := oldRow.label
+		if oldFlags, newFlags := strings.Join(oldRow.flags, " "), strings.Join(newRow.flags, " "); oldFlags != newFlags {
+			label = fmt.Sprintf("%s `%s` vs `%s`", label, oldFlags, newFlags)
+		} else if oldFlags != "" {
+			label = fmt.Sprintf("%s `%s`", label, oldFlags)
+		}
+		compareWriteRow(label, "Download", oldRow.download, newRow.download)
+		compareWriteRow(label, "Upload", oldRow.upload, newRow.upload)
+	}
+	return nil
+}
+
+// compareWriteRow writes the comparison of the old and new speeds.
+func compareWriteRow(label, direction string, oldSpeeds, newSpeeds []float64) {
+	if len(oldSpeeds) <= 0 || len(newSpeeds) <= 0 {
+		return
+	}
+	oldMedian, newMedian := stats.Median(oldSpeeds), stats.Median(newSpeeds)
+	pvalue := stats.UTest(oldSpeeds, newSpeeds)
+	delta := "~"
+	if stats.Significant(oldSpeeds, newSpeeds) && oldMedian > 0 {
+		delta = fmt.Sprintf("%+.1f%%", (newMedian-oldMedian)/oldMedian*100)
+	}
+	fmt.Printf("| %s | %s | %s | %s | %s | p=%.3f n=%d+%d |\n",
+		label, direction, humanize.SI(oldMedian, "bit/s"), humanize.SI(newMedian, "bit/s"),
+		delta, pvalue, len(oldSpeeds), len(newSpeeds))
+}
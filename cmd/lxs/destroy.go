@@ -19,15 +19,7 @@ func destroyMain(ctx context.Context, args []string) error {
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
 	runtimex.PanicOnError0(fset.Parse(args))
 
-	run("lxc stop %s-client", nameFlag)
-	run("lxc delete %s-client", nameFlag)
-	run("lxc stop %s-router", nameFlag)
-	run("lxc delete %s-router", nameFlag)
-	run("lxc stop %s-server", nameFlag)
-	run("lxc delete %s-server", nameFlag)
-
-	run("lxc network delete %s-left", nameFlag)
-	run("lxc network delete %s-right", nameFlag)
+	backendFor(nameFlag).Destroy(nameFlag)
 
 	return nil
 }
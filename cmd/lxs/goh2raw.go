@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+	"github.com/kballard/go-shellquote"
+)
+
+func measureGoH2RawMain(ctx context.Context, args []string) error {
+	var (
+		durationFlag     = ""
+		maxFrameSizeFlag = ""
+		nameFlag         = "ocho"
+		netProfileFlag   = ""
+		profileDirFlag   = ""
+		repeatFlag       = 0
+		warmupFlag       = 0
+	)
+
+	fset := vflag.NewFlagSet("lxs measure goh2raw", vflag.ExitOnError)
+	fset.StringVar(&durationFlag, 'd', "duration", "Transfer for `DURATION` instead of a number of bytes.")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.StringVar(&maxFrameSizeFlag, 0, "max-frame-size", "Accept DATA frames up to `BYTES`.")
+	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	tb := backendFor(nameFlag)
+	mustRun("go build -v ./cmd/goh2raw")
+	program := tb.Program(nameFlag, "client", "goh2raw")
+
+	cmdArgv := tb.Exec(nameFlag, "client", program, "measure", "-A", serverAddr)
+	if durationFlag != "" {
+		cmdArgv = append(cmdArgv, "-d", durationFlag)
+	}
+	if maxFrameSizeFlag != "" {
+		cmdArgv = append(cmdArgv, "--max-frame-size", maxFrameSizeFlag)
+	}
+	if repeatFlag > 0 {
+		cmdArgv = append(cmdArgv, "--repeat", strconv.Itoa(repeatFlag))
+	}
+	if warmupFlag > 0 {
+		cmdArgv = append(cmdArgv, "--warmup", strconv.Itoa(warmupFlag))
+	}
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("goh2raw-measure")...)
+	}
+	restoreShaping := runtimex.LogFatalOnError1(netProfileShape(nameFlag, netProfileFlag))
+	err := run("%s", shellquote.Join(cmdArgv...))
+	restoreShaping()
+	runtimex.LogFatalOnError0(err)
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "client", "goh2raw-measure", profileDirFlag)
+	}
+
+	return nil
+}
+
+func serveGoH2RawMain(ctx context.Context, args []string) error {
+	var (
+		nameFlag       = "ocho"
+		profileDirFlag = ""
+	)
+
+	fset := vflag.NewFlagSet("lxs serve goh2raw", vflag.ExitOnError)
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	tb := backendFor(nameFlag)
+	mustRun("go build -v ./cmd/goh2raw")
+	program := tb.Program(nameFlag, "server", "goh2raw")
+
+	cmdArgv := tb.Exec(nameFlag, "server", program, "serve", "-A", serverAddr)
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("goh2raw-serve")...)
+	}
+	mustRun("%s", shellquote.Join(cmdArgv...))
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "server", "goh2raw-serve", profileDirFlag)
+	}
+
+	return nil
+}
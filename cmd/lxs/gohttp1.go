@@ -4,7 +4,7 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"strconv"
 
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -13,61 +13,91 @@ import (
 
 func measureGoHTTP1Main(ctx context.Context, args []string) error {
 	var (
-		nameFlag   = "ocho"
-		methodFlag = ""
+		connectionsFlag   = 0
+		durationFlag      = ""
+		nameFlag          = "ocho"
+		netProfileFlag    = ""
+		methodFlag        = ""
+		probeIntervalFlag = ""
+		profileDirFlag    = ""
+		repeatFlag        = 0
+		warmupFlag        = 0
 	)
 
 	fset := vflag.NewFlagSet("lxs measure gohttp1", vflag.ExitOnError)
+	fset.IntVar(&connectionsFlag, 'C', "connections", "Use `N` parallel TCP connections.")
+	fset.StringVar(&durationFlag, 'd', "duration", "Transfer for `DURATION` instead of a number of bytes.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (PUT, GET).")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
+	fset.StringVar(&probeIntervalFlag, 0, "probe-interval", "Send responsiveness probes every `INTERVAL`.")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("go build -v ./cmd/gohttp1")
-	mustRun("lxc file push gohttp1 %s-client/root/", nameFlag)
+	program := tb.Program(nameFlag, "client", "gohttp1")
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-client", nameFlag),
-		"--",
-		"/root/gohttp1",
-		"measure",
-		"-A",
-		serverAddr,
+	cmdArgv := tb.Exec(nameFlag, "client", program, "measure", "-A", serverAddr)
+	if connectionsFlag > 0 {
+		cmdArgv = append(cmdArgv, "-C", strconv.Itoa(connectionsFlag))
+	}
+	if durationFlag != "" {
+		cmdArgv = append(cmdArgv, "-d", durationFlag)
 	}
 	if methodFlag != "" {
 		cmdArgv = append(cmdArgv, "-X", methodFlag)
 	}
-	mustRun("%s", shellquote.Join(cmdArgv...))
+	if probeIntervalFlag != "" {
+		cmdArgv = append(cmdArgv, "--probe-interval", probeIntervalFlag)
+	}
+	if repeatFlag > 0 {
+		cmdArgv = append(cmdArgv, "--repeat", strconv.Itoa(repeatFlag))
+	}
+	if warmupFlag > 0 {
+		cmdArgv = append(cmdArgv, "--warmup", strconv.Itoa(warmupFlag))
+	}
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("gohttp1-measure")...)
+	}
+	restoreShaping := runtimex.LogFatalOnError1(netProfileShape(nameFlag, netProfileFlag))
+	err := run("%s", shellquote.Join(cmdArgv...))
+	restoreShaping()
+	runtimex.LogFatalOnError0(err)
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "client", "gohttp1-measure", profileDirFlag)
+	}
 
 	return nil
 }
 
 func serveGoHTTP1Main(ctx context.Context, args []string) error {
 	var (
-		nameFlag = "ocho"
+		nameFlag       = "ocho"
+		profileDirFlag = ""
 	)
 
 	fset := vflag.NewFlagSet("lxs serve gohttp1", vflag.ExitOnError)
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("go build -v ./cmd/gohttp1")
-	mustRun("lxc file push gohttp1 %s-server/root/", nameFlag)
+	program := tb.Program(nameFlag, "server", "gohttp1")
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-server", nameFlag),
-		"--",
-		"/root/gohttp1",
-		"serve",
-		"-A",
-		serverAddr,
+	cmdArgv := tb.Exec(nameFlag, "server", program, "serve", "-A", serverAddr)
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("gohttp1-serve")...)
 	}
 	mustRun("%s", shellquote.Join(cmdArgv...))
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "server", "gohttp1-serve", profileDirFlag)
+	}
 
 	return nil
 }
@@ -4,7 +4,8 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"math"
+	"strconv"
 
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -13,61 +14,106 @@ import (
 
 func measureGoHTTP2cMain(ctx context.Context, args []string) error {
 	var (
-		nameFlag   = "ocho"
-		methodFlag = ""
+		connectionsFlag   = 0
+		durationFlag      = ""
+		nameFlag          = "ocho"
+		netProfileFlag    = ""
+		methodFlag        = ""
+		probeIntervalFlag = ""
+		profileDirFlag    = ""
+		repeatFlag        = 0
+		streamsFlag       = 0
+		warmupFlag        = 0
 	)
 
 	fset := vflag.NewFlagSet("lxs measure gohttp2c", vflag.ExitOnError)
+	fset.IntVar(&connectionsFlag, 'C', "connections", "Use `N` parallel TCP connections.")
+	fset.StringVar(&durationFlag, 'd', "duration", "Transfer for `DURATION` instead of a number of bytes.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (PUT, GET).")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
+	fset.StringVar(&probeIntervalFlag, 0, "probe-interval", "Send responsiveness probes every `INTERVAL`.")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.IntVar(&streamsFlag, 'P', "streams", "Use `N` concurrent streams over a single connection.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	fset.SetMinMaxPositionalArgs(0, math.MaxInt) // forwarded to the command
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("go build -v ./cmd/gohttp2c")
-	mustRun("lxc file push gohttp2c %s-client/root/", nameFlag)
+	program := tb.Program(nameFlag, "client", "gohttp2c")
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-client", nameFlag),
-		"--",
-		"/root/gohttp2c",
-		"measure",
-		"-A",
-		serverAddr,
+	cmdArgv := tb.Exec(nameFlag, "client", program, "measure", "-A", serverAddr)
+	if connectionsFlag > 0 {
+		cmdArgv = append(cmdArgv, "-C", strconv.Itoa(connectionsFlag))
+	}
+	if durationFlag != "" {
+		cmdArgv = append(cmdArgv, "-d", durationFlag)
 	}
 	if methodFlag != "" {
 		cmdArgv = append(cmdArgv, "-X", methodFlag)
 	}
-	mustRun("%s", shellquote.Join(cmdArgv...))
+	if streamsFlag > 0 {
+		cmdArgv = append(cmdArgv, "-P", strconv.Itoa(streamsFlag))
+	}
+	if probeIntervalFlag != "" {
+		cmdArgv = append(cmdArgv, "--probe-interval", probeIntervalFlag)
+	}
+	if repeatFlag > 0 {
+		cmdArgv = append(cmdArgv, "--repeat", strconv.Itoa(repeatFlag))
+	}
+	if warmupFlag > 0 {
+		cmdArgv = append(cmdArgv, "--warmup", strconv.Itoa(warmupFlag))
+	}
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("gohttp2c-measure")...)
+	}
+	cmdArgv = append(cmdArgv, fset.Args()...)
+	restoreShaping := runtimex.LogFatalOnError1(netProfileShape(nameFlag, netProfileFlag))
+	err := run("%s", shellquote.Join(cmdArgv...))
+	restoreShaping()
+	runtimex.LogFatalOnError0(err)
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "client", "gohttp2c-measure", profileDirFlag)
+	}
 
 	return nil
 }
 
 func serveGoHTTP2cMain(ctx context.Context, args []string) error {
 	var (
-		nameFlag = "ocho"
+		multiWriterFlag = false
+		nameFlag        = "ocho"
+		profileDirFlag  = ""
 	)
 
 	fset := vflag.NewFlagSet("lxs serve gohttp2c", vflag.ExitOnError)
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.BoolVar(&multiWriterFlag, 0, "multi-writer", "Use the experimental multi-writer server.")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
+	fset.SetMinMaxPositionalArgs(0, math.MaxInt) // forwarded to the command
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("go build -v ./cmd/gohttp2c")
-	mustRun("lxc file push gohttp2c %s-server/root/", nameFlag)
+	program := tb.Program(nameFlag, "server", "gohttp2c")
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-server", nameFlag),
-		"--",
-		"/root/gohttp2c",
-		"serve",
-		"-A",
-		serverAddr,
+	serveCmd := "serve"
+	if multiWriterFlag {
+		serveCmd = "serve-mw"
 	}
+	cmdArgv := tb.Exec(nameFlag, "server", program, serveCmd, "-A", serverAddr)
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("gohttp2c-serve")...)
+	}
+	cmdArgv = append(cmdArgv, fset.Args()...)
 	mustRun("%s", shellquote.Join(cmdArgv...))
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "server", "gohttp2c-serve", profileDirFlag)
+	}
 
 	return nil
 }
@@ -4,7 +4,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -28,7 +27,7 @@ func iperfMain(ctx context.Context, args []string) error {
 	fset.DisablePermute = true
 	runtimex.PanicOnError0(fset.Parse(args))
 
-	iperfArgv := []string{"lxc", "exec", fmt.Sprintf("%s-client", nameFlag), "--", "iperf3", "-c", serverAddr}
+	iperfArgv := backendFor(nameFlag).Exec(nameFlag, "client", "iperf3", "-c", serverAddr)
 	if congestionFlag != "" {
 		iperfArgv = append(iperfArgv, "-C", congestionFlag)
 	}
@@ -0,0 +1,82 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"path"
+)
+
+// lxcHome is the home directory of root inside the containers, which
+// is also the working directory used by lxc exec.
+const lxcHome = "/root"
+
+// lxcBackend is the [backend] using LXC containers connected by LXC
+// networks, which we create from the Debian bookworm image.
+type lxcBackend struct{}
+
+var _ backend = lxcBackend{}
+
+// Create implements [backend].
+func (tb lxcBackend) Create(name string) {
+	mustRun("lxc network create %s-left ipv4.address=none ipv6.address=none", name)
+	mustRun("lxc network create %s-right ipv4.address=none ipv6.address=none", name)
+
+	mustRun("lxc launch images:debian/bookworm %s-client", name)
+	mustRun("lxc launch images:debian/bookworm %s-router", name)
+	mustRun("lxc launch images:debian/bookworm %s-server", name)
+
+	mustRun("lxc network attach %s-left %s-client eth1", name, name)
+	mustRun("lxc network attach %s-left %s-router eth1", name, name)
+	mustRun("lxc network attach %s-right %s-router eth2", name, name)
+	mustRun("lxc network attach %s-right %s-server eth1", name, name)
+
+	configureTopology(tb, name)
+
+	mustRun("lxc exec %s-client -- apt update", name)
+	mustRun("lxc exec %s-client --env DEBIAN_FRONTEND=noninteractive -- apt install -y iperf3", name)
+
+	mustRun("lxc exec %s-server -- apt update", name)
+	mustRun("lxc exec %s-server --env DEBIAN_FRONTEND=noninteractive -- apt install -y iperf3", name)
+	mustRun("lxc exec %s-server -- systemctl enable iperf3", name)
+	mustRun("lxc exec %s-server -- service iperf3 start", name)
+}
+
+// Destroy implements [backend].
+func (tb lxcBackend) Destroy(name string) {
+	run("lxc stop %s-client", name)
+	run("lxc delete %s-client", name)
+	run("lxc stop %s-router", name)
+	run("lxc delete %s-router", name)
+	run("lxc stop %s-server", name)
+	run("lxc delete %s-server", name)
+
+	run("lxc network delete %s-left", name)
+	run("lxc network delete %s-right", name)
+}
+
+// Exec implements [backend].
+func (tb lxcBackend) Exec(name, node string, argv ...string) []string {
+	return append([]string{"lxc", "exec", fmt.Sprintf("%s-%s", name, node), "--"}, argv...)
+}
+
+// Kill implements [backend].
+func (tb lxcBackend) Kill(name, node, program string) error {
+	return runArgv(tb.Exec(name, node, "pkill", "-x", program)...)
+}
+
+// Program implements [backend].
+func (tb lxcBackend) Program(name, node, program string) string {
+	tb.Push(name, node, program)
+	return path.Join(lxcHome, path.Base(program))
+}
+
+// Pull implements [backend].
+func (tb lxcBackend) Pull(name, node, file, dest string) error {
+	return run("lxc file pull %s-%s%s %s", name, node, path.Join(lxcHome, file), dest)
+}
+
+// Push implements [backend].
+func (tb lxcBackend) Push(name, node, file string) {
+	mustRun("lxc file push %s %s-%s%s/", file, name, node, lxcHome)
+}
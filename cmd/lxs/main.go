@@ -12,6 +12,7 @@ import (
 
 func main() {
 	serveDisp := vclip.NewDispatcherCommand("lxs serve", vflag.ExitOnError)
+	serveDisp.AddCommand("goh2raw", vclip.CommandFunc(serveGoH2RawMain), "Run goh2raw service")
 	serveDisp.AddCommand("gohttp1", vclip.CommandFunc(serveGoHTTP1Main), "Run gohttp1 service")
 	serveDisp.AddCommand("gohttp2", vclip.CommandFunc(serveGoHTTP2Main), "Run gohttp2 service")
 	serveDisp.AddCommand("gohttp2c", vclip.CommandFunc(serveGoHTTP2cMain), "Run gohttp2c service")
@@ -19,6 +20,7 @@ func main() {
 	serveDisp.AddCommand("rusthttp2", vclip.CommandFunc(serveRustHTTP2Main), "Run rusthttp2 service")
 
 	measureDisp := vclip.NewDispatcherCommand("lxs measure", vflag.ExitOnError)
+	measureDisp.AddCommand("goh2raw", vclip.CommandFunc(measureGoH2RawMain), "Measure with goh2raw")
 	measureDisp.AddCommand("gohttp1", vclip.CommandFunc(measureGoHTTP1Main), "Measure with gohttp1")
 	measureDisp.AddCommand("gohttp2", vclip.CommandFunc(measureGoHTTP2Main), "Measure with gohttp2")
 	measureDisp.AddCommand("gohttp2c", vclip.CommandFunc(measureGoHTTP2cMain), "Measure with gohttp2c")
@@ -27,11 +29,15 @@ func main() {
 
 	disp := vclip.NewDispatcherCommand("lxs", vflag.ExitOnError)
 
+	disp.AddCommand("compare", vclip.CommandFunc(compareMain), "Compare two sweeps.")
 	disp.AddCommand("create", vclip.CommandFunc(createMain), "Create containers.")
 	disp.AddCommand("destroy", vclip.CommandFunc(destroyMain), "Destroy containers.")
 	disp.AddCommand("iperf", vclip.CommandFunc(iperfMain), "Run iperf3.")
 	disp.AddCommand("measure", measureDisp, "Run measurements.")
+	disp.AddCommand("report", vclip.CommandFunc(reportMain), "Render the results table.")
 	disp.AddCommand("serve", serveDisp, "Run servers.")
+	disp.AddCommand("shape", vclip.CommandFunc(shapeMain), "Shape the router traffic.")
+	disp.AddCommand("sweep", vclip.CommandFunc(sweepMain), "Run a parameter matrix.")
 
 	vclip.Main(context.Background(), disp, os.Args[1:])
 }
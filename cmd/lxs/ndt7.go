@@ -4,7 +4,8 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"math"
+	"strconv"
 
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -13,66 +14,98 @@ import (
 
 func measureNDT7Main(ctx context.Context, args []string) error {
 	var (
-		nameFlag   = "ocho"
-		methodFlag = ""
+		nameFlag       = "ocho"
+		netProfileFlag = ""
+		methodFlag     = ""
+		noTLSFlag      = false
+		profileDirFlag = ""
+		repeatFlag     = 0
+		warmupFlag     = 0
 	)
 
 	fset := vflag.NewFlagSet("lxs measure ndt7", vflag.ExitOnError)
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (GET for download, PUT for upload).")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
+	fset.BoolVar(&noTLSFlag, 0, "no-tls", "Use WebSocket over cleartext (ws://).")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	fset.SetMinMaxPositionalArgs(0, math.MaxInt) // forwarded to the command
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("go build -v ./cmd/ndt7")
-	mustRun("lxc file push ndt7 %s-client/root/", nameFlag)
+	program := tb.Program(nameFlag, "client", "ndt7")
+	if !noTLSFlag {
+		tb.Push(nameFlag, "client", "testdata/cert.pem")
+	}
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-client", nameFlag),
-		"--",
-		"/root/ndt7",
-		"measure",
-		"-A",
-		serverAddr,
+	cmdArgv := tb.Exec(nameFlag, "client", program, "measure", "-A", serverAddr)
+	if noTLSFlag {
+		cmdArgv = append(cmdArgv, "--no-tls")
 	}
 	if methodFlag != "" {
 		cmdArgv = append(cmdArgv, "-X", methodFlag)
 	}
-	mustRun("%s", shellquote.Join(cmdArgv...))
+	if repeatFlag > 0 {
+		cmdArgv = append(cmdArgv, "--repeat", strconv.Itoa(repeatFlag))
+	}
+	if warmupFlag > 0 {
+		cmdArgv = append(cmdArgv, "--warmup", strconv.Itoa(warmupFlag))
+	}
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("ndt7-measure")...)
+	}
+	cmdArgv = append(cmdArgv, fset.Args()...)
+	restoreShaping := runtimex.LogFatalOnError1(netProfileShape(nameFlag, netProfileFlag))
+	err := run("%s", shellquote.Join(cmdArgv...))
+	restoreShaping()
+	runtimex.LogFatalOnError0(err)
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "client", "ndt7-measure", profileDirFlag)
+	}
 
 	return nil
 }
 
 func serveNDT7Main(ctx context.Context, args []string) error {
 	var (
-		nameFlag = "ocho"
+		nameFlag       = "ocho"
+		noTLSFlag      = false
+		profileDirFlag = ""
 	)
 
 	fset := vflag.NewFlagSet("lxs serve ndt7", vflag.ExitOnError)
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.BoolVar(&noTLSFlag, 0, "no-tls", "Serve WebSocket over cleartext (ws://).")
+	fset.StringVar(&profileDirFlag, 0, "profile-dir", "Collect CPU, heap and trace profiles into `DIR`.")
 	runtimex.PanicOnError0(fset.Parse(args))
 
-	mustRun("go build -v ./cmd/gencert")
+	tb := backendFor(nameFlag)
 	mustRun("go build -v ./cmd/ndt7")
 
-	mustRun("./gencert --ip-addr %s", serverAddr)
-	mustRun("lxc file push testdata/cert.pem %s-server/root/", nameFlag)
-	mustRun("lxc file push testdata/key.pem %s-server/root/", nameFlag)
-	mustRun("lxc file push ndt7 %s-server/root/", nameFlag)
+	if !noTLSFlag {
+		mustRun("go build -v ./cmd/gencert")
+		mustRun("./gencert --ip-addr %s", serverAddr)
+		tb.Push(nameFlag, "server", "testdata/cert.pem")
+		tb.Push(nameFlag, "server", "testdata/key.pem")
+	}
+	program := tb.Program(nameFlag, "server", "ndt7")
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-server", nameFlag),
-		"--",
-		"/root/ndt7",
-		"serve",
-		"-A",
-		serverAddr,
+	cmdArgv := tb.Exec(nameFlag, "server", program, "serve", "-A", serverAddr)
+	if noTLSFlag {
+		cmdArgv = append(cmdArgv, "--no-tls")
+	}
+	if profileDirFlag != "" {
+		cmdArgv = append(cmdArgv, profileArgs("ndt7-serve")...)
 	}
 	mustRun("%s", shellquote.Join(cmdArgv...))
+	if profileDirFlag != "" {
+		profilePull(tb, nameFlag, "server", "ndt7-serve", profileDirFlag)
+	}
 
 	return nil
 }
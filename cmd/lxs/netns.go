@@ -0,0 +1,142 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/bassosimone/runtimex"
+)
+
+// netnsRunDir is where ip netns creates the named network namespaces.
+const netnsRunDir = "/run/netns"
+
+// netnsBackend is the [backend] using network namespaces connected by veth
+// pairs, which runs the locally built programs and needs no images. The
+// nodes share the host file system, so each node gets a home directory
+// under [os.TempDir] to keep their files separated.
+type netnsBackend struct{}
+
+var _ backend = netnsBackend{}
+
+// netnsNodes contains the nodes of the topology.
+var netnsNodes = []string{"client", "router", "server"}
+
+// netnsHome returns the home directory of the given node.
+func netnsHome(name, node string) string {
+	return filepath.Join(os.TempDir(), "lxs-"+name, node)
+}
+
+// Create implements [backend].
+func (tb netnsBackend) Create(name string) {
+	for _, node := range netnsNodes {
+		runtimex.LogFatalOnError0(os.MkdirAll(netnsHome(name, node), 0755))
+		mustRun("ip netns add %s-%s", name, node)
+		mustRunArgv(tb.Exec(name, node, "ip", "link", "set", "lo", "up")...)
+	}
+
+	// We create the veth pairs directly inside the namespaces, so we can use
+	// the same interface names as the containers, which lxs shape relies on.
+	mustRun("ip link add eth1 netns %s-client type veth peer name eth1 netns %s-router", name, name)
+	mustRun("ip link add eth1 netns %s-server type veth peer name eth2 netns %s-router", name, name)
+
+	configureTopology(tb, name)
+
+	// Like the containers, run the iperf3 server, if installed.
+	if err := runArgv(tb.Exec(name, "server", "iperf3", "--server", "--daemon")...); err != nil {
+		slog.Warn("cannot start the iperf3 server", slog.Any("err", err))
+	}
+}
+
+// Destroy implements [backend].
+func (tb netnsBackend) Destroy(name string) {
+	for _, node := range netnsNodes {
+		// Deleting the namespace does not stop its processes, which would
+		// otherwise keep the namespace and its veth pairs alive.
+		_ = tb.Kill(name, node, "")
+		run("ip netns del %s-%s", name, node)
+	}
+	if err := os.RemoveAll(filepath.Join(os.TempDir(), "lxs-"+name)); err != nil {
+		slog.Warn("cannot remove the home directories", slog.Any("err", err))
+	}
+}
+
+// Exec implements [backend].
+func (tb netnsBackend) Exec(name, node string, argv ...string) []string {
+	// We use env -C to run inside the node's home directory.
+	prefix := []string{"ip", "netns", "exec", fmt.Sprintf("%s-%s", name, node), "env", "-C", netnsHome(name, node)}
+	return append(prefix, argv...)
+}
+
+// Kill implements [backend]. When program is empty, it kills all the
+// processes running inside the node.
+func (tb netnsBackend) Kill(name, node, program string) error {
+	cmd, err := command("ip netns pids %s-%s", name, node)
+	if err != nil {
+		return err
+	}
+	output, err := cmd.Output()
+	if err != nil {
+		return err
+	}
+	var killed int
+	for field := range strings.FieldsSeq(string(output)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		// The kernel truncates comm to 15 characters, like pkill -x does.
+		comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+		if err != nil || (program != "" && strings.TrimSpace(string(comm)) != program) {
+			continue
+		}
+		proc, err := os.FindProcess(pid)
+		if err != nil || proc.Signal(syscall.SIGTERM) != nil {
+			continue
+		}
+		killed++
+	}
+	if killed <= 0 && program != "" {
+		return fmt.Errorf("no %s process running in %s-%s", program, name, node)
+	}
+	return nil
+}
+
+// Program implements [backend].
+func (tb netnsBackend) Program(name, node, program string) string {
+	return runtimex.LogFatalOnError1(filepath.Abs(program))
+}
+
+// Pull implements [backend].
+func (tb netnsBackend) Pull(name, node, file, dest string) error {
+	return netnsCopy(filepath.Join(netnsHome(name, node), file), dest)
+}
+
+// Push implements [backend].
+func (tb netnsBackend) Push(name, node, file string) {
+	runtimex.LogFatalOnError0(netnsCopy(file, filepath.Join(netnsHome(name, node), filepath.Base(file))))
+}
+
+// netnsCopy copies the source file to dest.
+func netnsCopy(source, dest string) error {
+	fmt.Fprintf(os.Stderr, "+ cp %s %s\n", source, dest)
+	input, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	output, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(output, input)
+	return errors.Join(err, output.Close())
+}
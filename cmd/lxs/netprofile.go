@@ -0,0 +1,71 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// netProfiles contains the named network profiles, which approximate
+// typical access networks so that we can reproduce the same conditions
+// across runs and machines. The delays are one-way.
+var netProfiles = map[string]*shapeState{
+	"cable": {
+		Down: &shapeConfig{Delay: 10 * time.Millisecond, Jitter: time.Millisecond, Rate: 200e6},
+		Up:   &shapeConfig{Delay: 10 * time.Millisecond, Jitter: time.Millisecond, Rate: 20e6},
+	},
+	"fiber-100ms": {
+		Down: &shapeConfig{Delay: 50 * time.Millisecond, Rate: 1e9},
+		Up:   &shapeConfig{Delay: 50 * time.Millisecond, Rate: 1e9},
+	},
+	"lossy-wifi": {
+		Down: &shapeConfig{Delay: 5 * time.Millisecond, Jitter: 3 * time.Millisecond, Loss: 2, Rate: 100e6},
+		Up:   &shapeConfig{Delay: 5 * time.Millisecond, Jitter: 3 * time.Millisecond, Loss: 2, Rate: 50e6},
+	},
+	"lte": {
+		Down: &shapeConfig{Delay: 35 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 0.1, Rate: 50e6},
+		Up:   &shapeConfig{Delay: 35 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 0.1, Rate: 15e6},
+	},
+	"satellite": {
+		Down: &shapeConfig{Delay: 300 * time.Millisecond, Loss: 0.5, Rate: 100e6},
+		Up:   &shapeConfig{Delay: 300 * time.Millisecond, Loss: 0.5, Rate: 10e6},
+	},
+}
+
+// netProfileHelp is the help text of the --net-profile flags.
+var netProfileHelp = fmt.Sprintf("Shape the router using the given network `PROFILE` (%s).",
+	strings.Join(slices.Sorted(maps.Keys(netProfiles)), ", "))
+
+// netProfileLookup returns the [*shapeState] of the given profile.
+func netProfileLookup(profile string) (*shapeState, error) {
+	state, found := netProfiles[profile]
+	if !found {
+		return nil, fmt.Errorf("unknown network profile: %q", profile)
+	}
+	return &shapeState{Down: state.Down, Profile: profile, Up: state.Up}, nil
+}
+
+// netProfileShape applies the given profile to the router and returns the
+// function restoring the previous shaping. When the profile is empty, it
+// leaves the shaping unchanged and returns a function doing nothing.
+func netProfileShape(name, profile string) (func(), error) {
+	if profile == "" {
+		return func() {}, nil
+	}
+	state, err := netProfileLookup(profile)
+	if err != nil {
+		return nil, err
+	}
+	previous := shapeLoad(name)
+	shapeApply(name, state)
+	return func() {
+		if previous == nil {
+			previous = &shapeState{}
+		}
+		shapeApply(name, previous)
+	}, nil
+}
@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNetProfileCommands(t *testing.T) {
+	// The down commands shape the egress of eth1, the up commands that of eth2.
+	tests := []struct {
+		profile string
+		down    []string
+		up      []string
+	}{
+		{
+			profile: "cable",
+			down: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 10000us 1000us",
+				"tc qdisc add dev eth1 parent 1:1 handle 10: tbf rate 200000000bit burst 100000 limit 1250000",
+			},
+			up: []string{
+				"tc qdisc add dev eth2 root handle 1: netem limit 100000 delay 10000us 1000us",
+				"tc qdisc add dev eth2 parent 1:1 handle 10: tbf rate 20000000bit burst 15140 limit 125000",
+			},
+		},
+		{
+			profile: "fiber-100ms",
+			down: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 50000us",
+				"tc qdisc add dev eth1 parent 1:1 handle 10: tbf rate 1000000000bit burst 500000 limit 6250000",
+			},
+			up: []string{
+				"tc qdisc add dev eth2 root handle 1: netem limit 100000 delay 50000us",
+				"tc qdisc add dev eth2 parent 1:1 handle 10: tbf rate 1000000000bit burst 500000 limit 6250000",
+			},
+		},
+		{
+			profile: "lossy-wifi",
+			down: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 5000us 3000us loss 2%",
+				"tc qdisc add dev eth1 parent 1:1 handle 10: tbf rate 100000000bit burst 50000 limit 625000",
+			},
+			up: []string{
+				"tc qdisc add dev eth2 root handle 1: netem limit 100000 delay 5000us 3000us loss 2%",
+				"tc qdisc add dev eth2 parent 1:1 handle 10: tbf rate 50000000bit burst 25000 limit 312500",
+			},
+		},
+		{
+			profile: "lte",
+			down: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 35000us 10000us loss 0.1%",
+				"tc qdisc add dev eth1 parent 1:1 handle 10: tbf rate 50000000bit burst 25000 limit 312500",
+			},
+			up: []string{
+				"tc qdisc add dev eth2 root handle 1: netem limit 100000 delay 35000us 10000us loss 0.1%",
+				"tc qdisc add dev eth2 parent 1:1 handle 10: tbf rate 15000000bit burst 15140 limit 93750",
+			},
+		},
+		{
+			profile: "satellite",
+			down: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 300000us loss 0.5%",
+				"tc qdisc add dev eth1 parent 1:1 handle 10: tbf rate 100000000bit burst 50000 limit 625000",
+			},
+			up: []string{
+				"tc qdisc add dev eth2 root handle 1: netem limit 100000 delay 300000us loss 0.5%",
+				"tc qdisc add dev eth2 parent 1:1 handle 10: tbf rate 10000000bit burst 15140 limit 62500",
+			},
+		},
+	}
+
+	var tested []string
+	for _, tt := range tests {
+		tested = append(tested, tt.profile)
+		t.Run(tt.profile, func(t *testing.T) {
+			state, err := netProfileLookup(tt.profile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Profile != tt.profile {
+				t.Fatalf("Profile = %q, want %q", state.Profile, tt.profile)
+			}
+			for _, config := range []*shapeConfig{state.Down, state.Up} {
+				if err := config.validate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := shapeCommands("eth1", state.Down); !slices.Equal(got, tt.down) {
+				t.Fatalf("down commands =\n%q\nwant\n%q", got, tt.down)
+			}
+			if got := shapeCommands("eth2", state.Up); !slices.Equal(got, tt.up) {
+				t.Fatalf("up commands =\n%q\nwant\n%q", got, tt.up)
+			}
+		})
+	}
+
+	// Make sure we update this test when adding a profile.
+	if profiles := slices.Sorted(maps.Keys(netProfiles)); !slices.Equal(profiles, tested) {
+		t.Fatalf("tested %v, want %v", tested, profiles)
+	}
+}
+
+func TestNetProfileLookup(t *testing.T) {
+	t.Run("unknown profile", func(t *testing.T) {
+		if _, err := netProfileLookup("dialup"); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("does not modify the profiles", func(t *testing.T) {
+		state, err := netProfileLookup("lte")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state == netProfiles["lte"] || netProfiles["lte"].Profile != "" {
+			t.Fatal("expected a copy of the profile")
+		}
+	})
+
+	t.Run("help lists the profiles", func(t *testing.T) {
+		const want = "(cable, fiber-100ms, lossy-wifi, lte, satellite)"
+		if !strings.Contains(netProfileHelp, want) {
+			t.Fatalf("help %q does not contain %q", netProfileHelp, want)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bassosimone/runtimex"
+)
+
+// profileFiles maps the profiling flags of the Go commands to the
+// suffix of the files where we write the profiles.
+var profileFiles = []struct {
+	flag   string
+	suffix string
+}{
+	{"--cpuprofile", "cpu.pprof"},
+	{"--memprofile", "mem.pprof"},
+	{"--trace", "trace.out"},
+}
+
+// profileArgs returns the flags to write the profiles into the node's
+// home directory using the given file name prefix.
+func profileArgs(prefix string) []string {
+	var args []string
+	for _, entry := range profileFiles {
+		args = append(args, entry.flag, fmt.Sprintf("%s-%s", prefix, entry.suffix))
+	}
+	return args
+}
+
+// profilePull pulls the profiles written using [profileArgs] from the
+// node into dir, removing them from the node.
+//
+// We ignore pull errors because a failing command does not write profiles.
+func profilePull(tb backend, name, node, prefix, dir string) {
+	runtimex.LogFatalOnError0(os.MkdirAll(dir, 0755))
+	for _, entry := range profileFiles {
+		file := fmt.Sprintf("%s-%s", prefix, entry.suffix)
+		_ = tb.Pull(name, node, file, filepath.Join(dir, file))
+		mustRunArgv(tb.Exec(name, node, "rm", "-f", file)...)
+	}
+}
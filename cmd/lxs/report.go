@@ -0,0 +1,364 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+	"github.com/bassosimone/2026-02-http2-perf/internal/stats"
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+)
+
+// reportRow is a row of the results table.
+type reportRow struct {
+	// download contains the download speeds in bit/s.
+	download []float64
+
+	// flags contains the stack flags.
+	flags []string
+
+	// label is the human-readable name of the stack.
+	label string
+
+	// upload contains the upload speeds in bit/s.
+	upload []float64
+}
+
+func reportMain(ctx context.Context, args []string) error {
+	var (
+		formatFlag = "markdown"
+		outputFlag = ""
+		readmeFlag = ""
+	)
+
+	fset := vflag.NewFlagSet("lxs report", vflag.ExitOnError)
+	fset.StringVar(&formatFlag, 'f', "format", "Use the given output `FORMAT` (markdown, csv).")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.StringVar(&outputFlag, 'o', "output", "Write the table to `FILE` instead of stdout.")
+	fset.StringVar(&readmeFlag, 0, "readme", "Replace the results table in the given markdown `FILE`.")
+	fset.SetMinMaxPositionalArgs(1, math.MaxInt) // the sweep directories
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	var rows []*reportRow
+	for _, dir := range fset.Args() {
+		rows = runtimex.LogFatalOnError1(reportLoad(dir, rows))
+	}
+	slices.SortStableFunc(rows, func(a, b *reportRow) int {
+		if aIperf, bIperf := a.label == reportIperfLabel, b.label == reportIperfLabel; aIperf != bIperf {
+			if aIperf {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(stats.Median(b.download), stats.Median(a.download))
+	})
+
+	// Preserve the hand-written notes of the table we are replacing.
+	var notes map[string]string
+	if readmeFlag != "" {
+		notes = runtimex.LogFatalOnError1(reportReadmeNotes(readmeFlag))
+	}
+
+	buf := &bytes.Buffer{}
+	switch formatFlag {
+	case "csv":
+		runtimex.LogFatalOnError0(reportWriteCSV(buf, rows))
+	case "markdown":
+		reportWriteMarkdown(buf, rows, notes)
+	default:
+		runtimex.LogFatalOnError0(fmt.Errorf("invalid format: %q", formatFlag))
+	}
+
+	if readmeFlag != "" {
+		runtimex.Assert(formatFlag == "markdown")
+		runtimex.LogFatalOnError0(reportUpdateReadme(readmeFlag, buf.Bytes()))
+		return nil
+	}
+	if outputFlag != "" {
+		runtimex.LogFatalOnError0(os.WriteFile(outputFlag, buf.Bytes(), 0644))
+		return nil
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// reportIperfLabel is the label of the iperf3 baseline row.
+const reportIperfLabel = "iperf3 (raw TCP)"
+
+// reportLoad reads the results of the sweep in dir and adds them to rows.
+func reportLoad(dir string, rows []*reportRow) ([]*reportRow, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "sweep.json"))
+	if err != nil {
+		return nil, err
+	}
+	var manifest sweepManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range manifest.Runs {
+		if entry.Warmup {
+			continue
+		}
+		if entry.Failure != "" {
+			slog.Warn("skipping failed run", slog.String("dir", dir), slog.String("id", entry.ID))
+			continue
+		}
+		speeds, proto, err := reportSpeeds(dir, entry)
+		if err != nil {
+			slog.Warn("skipping run", slog.String("dir", dir), slog.String("id", entry.ID), slog.Any("err", err))
+			continue
+		}
+
+		label := reportLabel(entry, proto)
+		idx := slices.IndexFunc(rows, func(row *reportRow) bool {
+			return row.label == label && slices.Equal(row.flags, entry.Flags)
+		})
+		if idx < 0 {
+			rows = append(rows, &reportRow{flags: entry.Flags, label: label})
+			idx = len(rows) - 1
+		}
+		switch entry.Method {
+		case "GET":
+			rows[idx].download = append(rows[idx].download, speeds...)
+		case "PUT":
+			rows[idx].upload = append(rows[idx].upload, speeds...)
+		}
+	}
+	return rows, nil
+}
+
+// reportRustRegexp matches the rusthttp2 measure result line.
+var reportRustRegexp = regexp.MustCompile(`(?m)^(?:download|upload): bytes=(\d+) elapsed=([0-9.]+)ms`)
+
+// reportSpeeds returns the speeds in bit/s and the protocol used by a run,
+// which contains more than one speed when using measure --repeat.
+func reportSpeeds(dir string, entry *sweepRun) ([]float64, string, error) {
+	switch {
+	case entry.Stack == "iperf3":
+		data, err := os.ReadFile(filepath.Join(dir, entry.Report))
+		if err != nil {
+			return nil, "", err
+		}
+		var report struct {
+			End struct {
+				SumReceived struct {
+					BitsPerSecond float64 `json:"bits_per_second"`
+				} `json:"sum_received"`
+			} `json:"end"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, "", err
+		}
+		return []float64{report.End.SumReceived.BitsPerSecond}, "", nil
+
+	case entry.Report != "":
+		data, err := os.ReadFile(filepath.Join(dir, entry.Report))
+		if err != nil {
+			return nil, "", err
+		}
+		var report bench.Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, "", err
+		}
+		if report.Result == nil || report.Result.Elapsed <= 0 {
+			return nil, "", errors.New("no result in report")
+		}
+		if len(report.Repetitions) > 0 {
+			return bench.Speeds(report.Repetitions), report.Result.Proto, nil
+		}
+		return []float64{report.Result.Speed()}, report.Result.Proto, nil
+
+	default:
+		data, err := os.ReadFile(filepath.Join(dir, entry.Log))
+		if err != nil {
+			return nil, "", err
+		}
+		match := reportRustRegexp.FindSubmatch(data)
+		if match == nil {
+			return nil, "", errors.New("no result in log")
+		}
+		count := runtimex.PanicOnError1(strconv.ParseFloat(string(match[1]), 64))
+		millis := runtimex.PanicOnError1(strconv.ParseFloat(string(match[2]), 64))
+		if millis <= 0 {
+			return nil, "", errors.New("zero elapsed time in log")
+		}
+		return []float64{count * 8 / (millis / 1e3)}, "", nil
+	}
+}
+
+// reportLabel returns the human-readable name of the stack used by a run.
+func reportLabel(entry *sweepRun, proto string) string {
+	switch entry.Stack {
+	case "iperf3":
+		return reportIperfLabel
+	case "goh2raw":
+		return "Go h2c Framer (no TLS)"
+	case "gohttp1":
+		return "Go HTTP/1.1 cleartext"
+	case "gohttp2":
+		if proto == "HTTP/2.0" {
+			return "Go HTTP/2 + TLS"
+		}
+		return "Go HTTP/1.1 + TLS"
+	case "gohttp2c":
+		return "Go h2c (no TLS)"
+	case "ndt7":
+		if entry.TLS {
+			return "ndt7 (WebSocket + TLS)"
+		}
+		return "ndt7 (WebSocket, no TLS)"
+	case "rusthttp2":
+		if entry.TLS {
+			return "Rust HTTP/2 + TLS"
+		}
+		return "Rust h2c (no TLS)"
+	default:
+		return entry.Stack
+	}
+}
+
+// reportWriteMarkdown writes the rows as a markdown table. The notes map
+// the labels of the rows without flags to their notes, while the notes of
+// the other rows contain their flags.
+func reportWriteMarkdown(w io.Writer, rows []*reportRow, notes map[string]string) {
+	speed := func(values []float64) string {
+		if len(values) <= 0 {
+			return "n/a"
+		}
+		summary := stats.Summarize(values)
+		if summary.Count <= 1 || summary.Median <= 0 {
+			return humanize.SI(summary.Median, "bit/s")
+		}
+		spread := max(summary.Median-summary.CILow, summary.CIHigh-summary.Median) / summary.Median
+		return fmt.Sprintf("%s ±%.0f%%", humanize.SI(summary.Median, "bit/s"), spread*100)
+	}
+	fmt.Fprintf(w, "| Stack | Download | Upload | n | Notes |\n")
+	fmt.Fprintf(w, "|---|---|---|---|---|\n")
+	for _, row := range rows {
+		note := notes[row.label]
+		if len(row.flags) > 0 {
+			note = fmt.Sprintf("`%s`", strings.Join(row.flags, " "))
+		}
+		count := fmt.Sprintf("%d/%d", len(row.download), len(row.upload))
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s |\n",
+			row.label, speed(row.download), speed(row.upload), count, note)
+	}
+}
+
+// reportWriteCSV writes the rows as CSV using bit/s.
+func reportWriteCSV(w io.Writer, rows []*reportRow) error {
+	header := []string{"stack", "flags"}
+	for _, direction := range []string{"download", "upload"} {
+		for _, field := range []string{"runs", "median", "mean", "stddev", "min", "max", "ci_low", "ci_high"} {
+			header = append(header, direction+"_"+field)
+		}
+	}
+	summarize := func(values []float64) []string {
+		if len(values) <= 0 {
+			return []string{"0", "", "", "", "", "", "", ""}
+		}
+		summary := stats.Summarize(values)
+		format := func(value float64) string {
+			return strconv.FormatFloat(value, 'f', 0, 64)
+		}
+		return []string{
+			strconv.Itoa(summary.Count),
+			format(summary.Median),
+			format(summary.Mean),
+			format(summary.Stddev),
+			format(summary.Min),
+			format(summary.Max),
+			format(summary.CILow),
+			format(summary.CIHigh),
+		}
+	}
+	writer := csv.NewWriter(w)
+	writer.Write(header)
+	for _, row := range rows {
+		record := []string{row.label, strings.Join(row.flags, " ")}
+		record = append(record, summarize(row.download)...)
+		record = append(record, summarize(row.upload)...)
+		writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// reportUpdateReadme replaces the first table in the "## Results" section of
+// the given markdown file with table.
+func reportUpdateReadme(path string, table []byte) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	start, end, err := reportReadmeTable(path, lines)
+	if err != nil {
+		return err
+	}
+	lines = slices.Replace(lines, start, end, string(table))
+	return os.WriteFile(path, []byte(strings.Join(lines, "")), 0644)
+}
+
+// reportReadmeNotes returns the last column of each row of the table that
+// [reportUpdateReadme] replaces, indexed by the first column.
+func reportReadmeNotes(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	start, end, err := reportReadmeTable(path, lines)
+	if err != nil {
+		return nil, err
+	}
+	notes := map[string]string{}
+	for _, line := range lines[min(start+2, end):end] { // skip the header and the separator
+		cells := strings.Split(strings.Trim(strings.TrimSpace(line), "|"), "|")
+		if len(cells) < 2 {
+			continue
+		}
+		notes[strings.TrimSpace(cells[0])] = strings.TrimSpace(cells[len(cells)-1])
+	}
+	return notes, nil
+}
+
+// reportReadmeTable returns the range of lines containing the first table
+// in the "## Results" section of the markdown file at path.
+func reportReadmeTable(path string, lines []string) (int, int, error) {
+	section := slices.Index(lines, "## Results\n")
+	if section < 0 {
+		return 0, 0, errors.New("no results section in " + path)
+	}
+	start := slices.IndexFunc(lines[section:], func(line string) bool {
+		return strings.HasPrefix(line, "|")
+	})
+	if start < 0 {
+		return 0, 0, errors.New("no results table in " + path)
+	}
+	start += section
+	end := start
+	for end < len(lines) && strings.HasPrefix(lines[end], "|") {
+		end++
+	}
+	return start, end, nil
+}
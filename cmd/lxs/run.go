@@ -4,6 +4,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 
@@ -11,16 +12,22 @@ import (
 	"github.com/kballard/go-shellquote"
 )
 
-func run(format string, args ...any) error {
+func command(format string, args ...any) (*exec.Cmd, error) {
 	cmdline := fmt.Sprintf(format, args...)
 	argv, err := shellquote.Split(cmdline)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	runtimex.Assert(len(argv) > 0)
 	fmt.Fprintf(os.Stderr, "+ %s\n", cmdline)
+	return exec.Command(argv[0], argv[1:]...), nil
+}
 
-	cmd := exec.Command(argv[0], argv[1:]...)
+func run(format string, args ...any) error {
+	cmd, err := command(format, args...)
+	if err != nil {
+		return err
+	}
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -28,6 +35,28 @@ func run(format string, args ...any) error {
 	return cmd.Run()
 }
 
+// runTee is like [run] but writes the command output to both stderr and w.
+func runTee(w io.Writer, format string, args ...any) error {
+	cmd, err := command(format, args...)
+	if err != nil {
+		return err
+	}
+	output := io.MultiWriter(os.Stderr, w)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	return cmd.Run()
+}
+
 func mustRun(format string, args ...any) {
 	runtimex.LogFatalOnError0(run(format, args...))
 }
+
+// runArgv is like [run] but takes the command line as an argv.
+func runArgv(argv ...string) error {
+	return run("%s", shellquote.Join(argv...))
+}
+
+func mustRunArgv(argv ...string) {
+	runtimex.LogFatalOnError0(runArgv(argv...))
+}
@@ -4,7 +4,6 @@ package main
 
 import (
 	"context"
-	"fmt"
 
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
@@ -13,42 +12,39 @@ import (
 
 func measureRustHTTP2Main(ctx context.Context, args []string) error {
 	var (
-		nameFlag   = "ocho"
-		methodFlag = ""
-		noTLSFlag  = false
+		nameFlag       = "ocho"
+		netProfileFlag = ""
+		methodFlag     = ""
+		noTLSFlag      = false
 	)
 
 	fset := vflag.NewFlagSet("lxs measure rusthttp2", vflag.ExitOnError)
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use the given HTTP `METHOD` (PUT, GET).")
 	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
 	fset.BoolVar(&noTLSFlag, 0, "no-tls", "Use h2c (HTTP/2 over cleartext).")
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("cargo build --release --target x86_64-unknown-linux-musl --manifest-path cmd/rusthttp2/Cargo.toml")
 	mustRun("cp cmd/rusthttp2/target/x86_64-unknown-linux-musl/release/rusthttp2 .")
-	mustRun("lxc file push rusthttp2 %s-client/root/", nameFlag)
+	program := tb.Program(nameFlag, "client", "rusthttp2")
 	if !noTLSFlag {
-		mustRun("lxc file push testdata/cert.pem %s-client/root/", nameFlag)
+		tb.Push(nameFlag, "client", "testdata/cert.pem")
 	}
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-client", nameFlag),
-		"--",
-		"/root/rusthttp2",
-		"measure",
-		"-A",
-		serverAddr,
-	}
+	cmdArgv := tb.Exec(nameFlag, "client", program, "measure", "-A", serverAddr)
 	if noTLSFlag {
 		cmdArgv = append(cmdArgv, "--no-tls")
 	}
 	if methodFlag != "" {
 		cmdArgv = append(cmdArgv, "-X", methodFlag)
 	}
-	mustRun("%s", shellquote.Join(cmdArgv...))
+	restoreShaping := runtimex.LogFatalOnError1(netProfileShape(nameFlag, netProfileFlag))
+	err := run("%s", shellquote.Join(cmdArgv...))
+	restoreShaping()
+	runtimex.LogFatalOnError0(err)
 
 	return nil
 }
@@ -65,27 +61,19 @@ func serveRustHTTP2Main(ctx context.Context, args []string) error {
 	fset.BoolVar(&noTLSFlag, 0, "no-tls", "Use h2c (HTTP/2 over cleartext).")
 	runtimex.PanicOnError0(fset.Parse(args))
 
+	tb := backendFor(nameFlag)
 	mustRun("cargo build --release --target x86_64-unknown-linux-musl --manifest-path cmd/rusthttp2/Cargo.toml")
 	mustRun("cp cmd/rusthttp2/target/x86_64-unknown-linux-musl/release/rusthttp2 .")
 
 	if !noTLSFlag {
 		mustRun("go build -v ./cmd/gencert")
 		mustRun("./gencert --ip-addr %s", serverAddr)
-		mustRun("lxc file push testdata/cert.pem %s-server/root/", nameFlag)
-		mustRun("lxc file push testdata/key.pem %s-server/root/", nameFlag)
+		tb.Push(nameFlag, "server", "testdata/cert.pem")
+		tb.Push(nameFlag, "server", "testdata/key.pem")
 	}
-	mustRun("lxc file push rusthttp2 %s-server/root/", nameFlag)
+	program := tb.Program(nameFlag, "server", "rusthttp2")
 
-	cmdArgv := []string{
-		"lxc",
-		"exec",
-		fmt.Sprintf("%s-server", nameFlag),
-		"--",
-		"/root/rusthttp2",
-		"serve",
-		"-A",
-		serverAddr,
-	}
+	cmdArgv := tb.Exec(nameFlag, "server", program, "serve", "-A", serverAddr)
 	if noTLSFlag {
 		cmdArgv = append(cmdArgv, "--no-tls")
 	}
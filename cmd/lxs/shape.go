@@ -0,0 +1,259 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+	"github.com/kballard/go-shellquote"
+)
+
+// shapeConfig describes the shaping of a direction.
+type shapeConfig struct {
+	// Delay is the one-way delay added by netem.
+	Delay time.Duration `json:"delay"`
+
+	// Jitter is the delay variation added by netem.
+	Jitter time.Duration `json:"jitter"`
+
+	// Loss is the percentage of packets dropped by netem.
+	Loss float64 `json:"loss"`
+
+	// Queue is the size in bytes of the tbf queue.
+	Queue int64 `json:"queue"`
+
+	// Rate is the tbf rate limit in bit/s or zero.
+	Rate int64 `json:"rate"`
+
+	// Reorder is the percentage of packets that netem sends immediately,
+	// thus reordering them with respect to the delayed packets.
+	Reorder float64 `json:"reorder"`
+}
+
+// shapeState is the active shaping, which we save on the router.
+type shapeState struct {
+	// Down is the shaping of the server-to-client direction or nil.
+	Down *shapeConfig `json:"down,omitempty"`
+
+	// Profile is the name of the network profile, if any.
+	Profile string `json:"profile,omitempty"`
+
+	// Up is the shaping of the client-to-server direction or nil.
+	Up *shapeConfig `json:"up,omitempty"`
+}
+
+// shapeStateFile is the file in the router home directory where
+// we save the [*shapeState].
+const shapeStateFile = "shape.json"
+
+// shapeNetemLimit is the netem queue size in packets, which must be large
+// enough to hold the packets in flight when adding delay.
+const shapeNetemLimit = 100000
+
+// shapeQueueLatency is the maximum queueing delay of the tbf queue
+// we use when the queue size is not set.
+const shapeQueueLatency = 50 * time.Millisecond
+
+func shapeMain(ctx context.Context, args []string) error {
+	var (
+		clearFlag      = false
+		delayFlag      = time.Duration(0)
+		directionFlag  = "both"
+		jitterFlag     = time.Duration(0)
+		lossFlag       = 0.0
+		nameFlag       = "ocho"
+		netProfileFlag = ""
+		queueFlag      = int64(0)
+		rateFlag       = ""
+		reorderFlag    = 0.0
+	)
+
+	fset := vflag.NewFlagSet("lxs shape", vflag.ExitOnError)
+	fset.BoolVar(&clearFlag, 0, "clear", "Remove the shaping.")
+	fset.DurationVar(&delayFlag, 0, "delay", "Add a one-way `DELAY` (e.g., 50ms).")
+	fset.StringVar(&directionFlag, 0, "direction", "Shape the given `DIRECTION` (both, down, up).")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.DurationVar(&jitterFlag, 0, "jitter", "Add a random delay variation of up to `JITTER`.")
+	fset.Float64Var(&lossFlag, 0, "loss", "Drop `PERCENT` of the packets.")
+	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
+	fset.Int64Var(&queueFlag, 0, "queue", "Use a rate limiter queue of `BYTES` bytes.")
+	fset.StringVar(&rateFlag, 0, "rate", "Limit the rate to `RATE` (e.g., 100mbit).")
+	fset.Float64Var(&reorderFlag, 0, "reorder", "Reorder `PERCENT` of the packets (requires --delay).")
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	if clearFlag {
+		shapeApply(nameFlag, &shapeState{})
+		return nil
+	}
+	if netProfileFlag != "" {
+		shapeApply(nameFlag, runtimex.LogFatalOnError1(netProfileLookup(netProfileFlag)))
+		return nil
+	}
+
+	config := &shapeConfig{
+		Delay:   delayFlag,
+		Jitter:  jitterFlag,
+		Loss:    lossFlag,
+		Queue:   queueFlag,
+		Reorder: reorderFlag,
+	}
+	if rateFlag != "" {
+		config.Rate = runtimex.LogFatalOnError1(shapeParseRate(rateFlag))
+	}
+	runtimex.LogFatalOnError0(config.validate())
+
+	state := &shapeState{}
+	switch directionFlag {
+	case "both":
+		state.Down, state.Up = config, config
+	case "down":
+		state.Down = config
+	case "up":
+		state.Up = config
+	default:
+		runtimex.LogFatalOnError0(fmt.Errorf("invalid direction: %q", directionFlag))
+	}
+	shapeApply(nameFlag, state)
+	return nil
+}
+
+// validate returns an error if netem or tbf would reject the config.
+func (c *shapeConfig) validate() error {
+	switch {
+	case c.Delay < 0 || c.Jitter < 0 || c.Queue < 0 || c.Rate < 0:
+		return errors.New("shaping values must not be negative")
+	case c.Loss < 0 || c.Loss > 100 || c.Reorder < 0 || c.Reorder > 100:
+		return errors.New("percentages must be between 0 and 100")
+	case c.Delay <= 0 && (c.Jitter > 0 || c.Reorder > 0):
+		return errors.New("jitter and reordering require a delay")
+	case c.Queue > 0 && c.Rate <= 0:
+		return errors.New("the queue size requires a rate")
+	default:
+		return nil
+	}
+}
+
+// shapeParseRate parses a rate using the tc units (bit, kbit, mbit, gbit)
+// and returns it in bit/s.
+func shapeParseRate(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"gbit", 1e9},
+		{"mbit", 1e6},
+		{"kbit", 1e3},
+		{"bit", 1},
+	}
+	for _, unit := range units {
+		if number, found := strings.CutSuffix(strings.ToLower(value), unit.suffix); found {
+			rate, err := strconv.ParseFloat(number, 64)
+			if err != nil || rate <= 0 {
+				return 0, fmt.Errorf("invalid rate: %q", value)
+			}
+			return int64(rate * unit.multiplier), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid rate: %q (use bit, kbit, mbit, or gbit)", value)
+}
+
+// shapeCommands returns the tc commands shaping the egress of iface.
+//
+// We use netem as the root qdisc and tbf as its child, so packets are
+// first delayed and then rate limited, as recommended by the netem docs.
+func shapeCommands(iface string, config *shapeConfig) []string {
+	var netem []string
+	if config.Delay > 0 {
+		netem = append(netem, "delay", fmt.Sprintf("%dus", config.Delay.Microseconds()))
+		if config.Jitter > 0 {
+			netem = append(netem, fmt.Sprintf("%dus", config.Jitter.Microseconds()))
+		}
+	}
+	if config.Loss > 0 {
+		netem = append(netem, "loss", fmt.Sprintf("%g%%", config.Loss))
+	}
+	if config.Reorder > 0 {
+		netem = append(netem, "reorder", fmt.Sprintf("%g%%", config.Reorder))
+	}
+
+	var commands []string
+	parent := "root"
+	if len(netem) > 0 {
+		commands = append(commands, fmt.Sprintf("tc qdisc add dev %s root handle 1: netem limit %d %s",
+			iface, shapeNetemLimit, strings.Join(netem, " ")))
+		parent = "parent 1:1"
+	}
+	if config.Rate > 0 {
+		// The bucket must hold at least the bytes sent in a timer tick, so
+		// we size it for 4 ms and never below 10 full-size packets.
+		burst := max(config.Rate/8/250, 15140)
+		queue := config.Queue
+		if queue <= 0 {
+			queue = max(int64(float64(config.Rate/8)*shapeQueueLatency.Seconds()), burst)
+		}
+		commands = append(commands, fmt.Sprintf("tc qdisc add dev %s %s handle 10: tbf rate %dbit burst %d limit %d",
+			iface, parent, config.Rate, burst, queue))
+	}
+	return commands
+}
+
+// shapeApply replaces the shaping on the router with state and saves it.
+//
+// The router forwards server-to-client packets through eth1 and
+// client-to-server packets through eth2, so we shape their egress.
+func shapeApply(name string, state *shapeState) {
+	tb := backendFor(name)
+	for _, entry := range []struct {
+		config *shapeConfig
+		iface  string
+	}{
+		{state.Down, "eth1"},
+		{state.Up, "eth2"},
+	} {
+		// Ignore the error occurring when there is no qdisc to delete.
+		_ = runArgv(tb.Exec(name, "router", "tc", "qdisc", "del", "dev", entry.iface, "root")...)
+		if entry.config == nil {
+			continue
+		}
+		for _, command := range shapeCommands(entry.iface, entry.config) {
+			mustRunArgv(tb.Exec(name, "router", strings.Fields(command)...)...)
+		}
+	}
+
+	if state.Down == nil && state.Up == nil {
+		mustRunArgv(tb.Exec(name, "router", "rm", "-f", shapeStateFile)...)
+		return
+	}
+	data := runtimex.PanicOnError1(json.MarshalIndent(state, "", "  "))
+	tempdir := runtimex.LogFatalOnError1(os.MkdirTemp("", "lxs-shape-"))
+	defer os.RemoveAll(tempdir)
+	filename := filepath.Join(tempdir, shapeStateFile)
+	runtimex.LogFatalOnError0(os.WriteFile(filename, append(data, '\n'), 0644))
+	tb.Push(name, "router", filename)
+}
+
+// shapeLoad returns the shaping saved on the router or nil if there is none.
+func shapeLoad(name string) *shapeState {
+	argv := backendFor(name).Exec(name, "router", "cat", shapeStateFile)
+	cmd := runtimex.LogFatalOnError1(command("%s", shellquote.Join(argv...)))
+	data, err := cmd.Output()
+	if err != nil {
+		return nil // the file does not exist when we are not shaping
+	}
+	var state shapeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil
+	}
+	return &state
+}
@@ -0,0 +1,143 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestShapeParseRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "100bit", want: 100},
+		{value: "64kbit", want: 64000},
+		{value: "100mbit", want: 100000000},
+		{value: "1.5mbit", want: 1500000},
+		{value: "10gbit", want: 10000000000},
+		{value: "100Mbit", want: 100000000},
+		{value: "100MBIT", want: 100000000},
+		{value: "", wantErr: true},
+		{value: "100", wantErr: true},
+		{value: "100mbps", wantErr: true},
+		{value: "mbit", wantErr: true},
+		{value: "fastmbit", wantErr: true},
+		{value: "0mbit", wantErr: true},
+		{value: "-1mbit", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := shapeParseRate(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("shapeParseRate(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("shapeParseRate(%q) = %d, want %d", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShapeConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  shapeConfig
+		wantErr bool
+	}{
+		{name: "empty", config: shapeConfig{}},
+		{name: "everything", config: shapeConfig{Delay: time.Millisecond, Jitter: time.Millisecond, Loss: 1, Queue: 1, Rate: 1, Reorder: 1}},
+		{name: "negative delay", config: shapeConfig{Delay: -1}, wantErr: true},
+		{name: "negative jitter", config: shapeConfig{Delay: 1, Jitter: -1}, wantErr: true},
+		{name: "negative queue", config: shapeConfig{Queue: -1, Rate: 1}, wantErr: true},
+		{name: "negative rate", config: shapeConfig{Rate: -1}, wantErr: true},
+		{name: "loss above 100", config: shapeConfig{Loss: 101}, wantErr: true},
+		{name: "negative reorder", config: shapeConfig{Delay: 1, Reorder: -1}, wantErr: true},
+		{name: "jitter without delay", config: shapeConfig{Jitter: 1}, wantErr: true},
+		{name: "reorder without delay", config: shapeConfig{Reorder: 1}, wantErr: true},
+		{name: "queue without rate", config: shapeConfig{Queue: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("validate() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShapeCommands(t *testing.T) {
+	tests := []struct {
+		name   string
+		config shapeConfig
+		want   []string
+	}{
+		{
+			name:   "nothing",
+			config: shapeConfig{},
+			want:   nil,
+		},
+		{
+			name:   "delay",
+			config: shapeConfig{Delay: 50 * time.Millisecond},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 50000us",
+			},
+		},
+		{
+			name:   "netem only",
+			config: shapeConfig{Delay: 20 * time.Millisecond, Jitter: 5 * time.Millisecond, Loss: 0.5, Reorder: 25},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 20000us 5000us loss 0.5% reorder 25%",
+			},
+		},
+		{
+			name:   "loss without delay",
+			config: shapeConfig{Loss: 1},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 loss 1%",
+			},
+		},
+		{
+			// The queue defaults to 50 ms at the rate, i.e., 625000 bytes.
+			name:   "rate only",
+			config: shapeConfig{Rate: 100e6},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 10: tbf rate 100000000bit burst 50000 limit 625000",
+			},
+		},
+		{
+			// The burst is at least 10 full-size packets and the queue at least the burst.
+			name:   "slow rate",
+			config: shapeConfig{Rate: 1e6},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 10: tbf rate 1000000bit burst 15140 limit 15140",
+			},
+		},
+		{
+			name:   "rate with queue",
+			config: shapeConfig{Queue: 1 << 20, Rate: 1e9},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 10: tbf rate 1000000000bit burst 500000 limit 1048576",
+			},
+		},
+		{
+			name:   "delay and rate",
+			config: shapeConfig{Delay: 50 * time.Millisecond, Rate: 1e9},
+			want: []string{
+				"tc qdisc add dev eth1 root handle 1: netem limit 100000 delay 50000us",
+				"tc qdisc add dev eth1 parent 1:1 handle 10: tbf rate 1000000000bit burst 500000 limit 6250000",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shapeCommands("eth1", &tt.config); !slices.Equal(got, tt.want) {
+				t.Fatalf("shapeCommands() =\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/runtimex"
+	"github.com/bassosimone/vflag"
+	"github.com/kballard/go-shellquote"
+)
+
+// sweepStack describes how [sweepMain] runs a stack.
+type sweepStack struct {
+	// duration indicates that measure accepts -d.
+	duration bool
+
+	// getOnly indicates that the stack only supports GET.
+	getOnly bool
+
+	// output indicates that measure accepts --output.
+	output bool
+
+	// profile indicates that serve and measure accept the profiling flags.
+	profile bool
+
+	// tls contains the supported TLS modes.
+	tls []bool
+}
+
+// sweepStacks contains the stacks [sweepMain] knows how to run.
+var sweepStacks = map[string]*sweepStack{
+	"goh2raw":   {duration: true, getOnly: true, output: true, profile: true, tls: []bool{false}},
+	"gohttp1":   {duration: true, output: true, profile: true, tls: []bool{false}},
+	"gohttp2":   {duration: true, output: true, profile: true, tls: []bool{true}},
+	"gohttp2c":  {duration: true, output: true, profile: true, tls: []bool{false}},
+	"ndt7":      {output: true, profile: true, tls: []bool{true, false}},
+	"rusthttp2": {tls: []bool{true, false}},
+}
+
+// sweepStartupDelay is the time we give servers to start listening.
+const sweepStartupDelay = 2 * time.Second
+
+// sweepReportFile is the file in the client home directory where
+// measure writes the JSON report.
+const sweepReportFile = "measure.json"
+
+// sweepManifest is the sweep.json file describing a sweep.
+type sweepManifest struct {
+	// Args contains the lxs sweep command line arguments.
+	Args []string `json:"args"`
+
+	// Runs contains the runs performed so far.
+	Runs []*sweepRun `json:"runs"`
+
+	// Shaping is the shaping active on the router, if any.
+	Shaping *shapeState `json:"shaping,omitempty"`
+
+	// Time is the time when the sweep started.
+	Time time.Time `json:"time"`
+}
+
+// sweepRun describes a single measurement within a sweep.
+type sweepRun struct {
+	// Failure is the error that occurred or an empty string.
+	Failure string `json:"failure"`
+
+	// Flags contains the stack flags passed to measure.
+	Flags []string `json:"flags"`
+
+	// ID uniquely identifies the run within the sweep.
+	ID string `json:"id"`
+
+	// Log is the file containing the measure output.
+	Log string `json:"log"`
+
+	// Method is the HTTP method (GET for download, PUT for upload).
+	Method string `json:"method"`
+
+	// Repetition is the zero-based repetition index, including warm-up runs.
+	Repetition int `json:"repetition"`
+
+	// Report is the file containing the JSON report, if any.
+	Report string `json:"report,omitempty"`
+
+	// Stack is the name of the stack.
+	Stack string `json:"stack"`
+
+	// TLS indicates whether the run used TLS.
+	TLS bool `json:"tls"`
+
+	// Warmup indicates a warm-up run, which lxs report ignores.
+	Warmup bool `json:"warmup,omitempty"`
+}
+
+func sweepMain(ctx context.Context, args []string) error {
+	var (
+		durationFlag   = ""
+		iperfFlag      = false
+		methodsFlag    = []string{}
+		nameFlag       = "ocho"
+		netProfileFlag = ""
+		outputFlag     = filepath.Join("results", time.Now().UTC().Format("20060102T150405Z"))
+		profileFlag    = false
+		repeatFlag     = 1
+		stacksFlag     = []string{}
+		tlsFlag        = []string{}
+		warmupFlag     = 0
+	)
+
+	fset := vflag.NewFlagSet("lxs sweep", vflag.ExitOnError)
+	fset.StringVar(&durationFlag, 'd', "duration", "Transfer for `DURATION` with the stacks supporting it.")
+	fset.AutoHelp('h', "help", "Print this help text and exit.")
+	fset.BoolVar(&iperfFlag, 0, "iperf", "Also run iperf3 to measure the baseline.")
+	fset.StringSliceVar(&methodsFlag, 'X', "method", "Add the given HTTP `METHOD` (PUT, GET) to the matrix.")
+	fset.StringVar(&nameFlag, 'n', "name", "Use `NAME` to name LXC resources.")
+	fset.StringVar(&netProfileFlag, 0, "net-profile", netProfileHelp)
+	fset.StringVar(&outputFlag, 'o', "output-dir", "Write results into `DIR`.")
+	fset.BoolVar(&profileFlag, 0, "profile", "Collect CPU, heap and trace profiles of the Go stacks.")
+	fset.IntVar(&repeatFlag, 'r', "repeat", "Repeat each combination `N` times.")
+	fset.StringSliceVar(&stacksFlag, 's', "stack", "Add the given `STACK` (e.g., 'gohttp2 -2 -P 4') to the matrix.")
+	fset.StringSliceVar(&tlsFlag, 0, "tls", "Add the given TLS `MODE` (on, off) to the matrix.")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up repetitions first.")
+	fset.SetMinMaxPositionalArgs(0, math.MaxInt) // forwarded to every measure command
+	runtimex.PanicOnError0(fset.Parse(args))
+
+	runtimex.Assert(repeatFlag >= 1 && warmupFlag >= 0)
+	if len(methodsFlag) <= 0 {
+		methodsFlag = []string{"GET", "PUT"}
+	}
+	if len(stacksFlag) <= 0 {
+		stacksFlag = slices.Sorted(maps.Keys(sweepStacks))
+	}
+	if len(tlsFlag) <= 0 {
+		tlsFlag = []string{"on", "off"}
+	}
+	var tlsModes []bool
+	for _, mode := range tlsFlag {
+		switch mode {
+		case "on":
+			tlsModes = append(tlsModes, true)
+		case "off":
+			tlsModes = append(tlsModes, false)
+		default:
+			runtimex.LogFatalOnError0(fmt.Errorf("invalid TLS mode: %q", mode))
+		}
+	}
+
+	// Parse the stacks first, so we fail before doing any work.
+	type stackSpec struct {
+		flags []string
+		name  string
+		stack *sweepStack
+	}
+	var specs []stackSpec
+	for _, value := range stacksFlag {
+		words := runtimex.LogFatalOnError1(shellquote.Split(value))
+		runtimex.Assert(len(words) > 0)
+		stack, found := sweepStacks[words[0]]
+		if !found {
+			runtimex.LogFatalOnError0(fmt.Errorf("unknown stack: %q", words[0]))
+		}
+		specs = append(specs, stackSpec{flags: append(words[1:], fset.Args()...), name: words[0], stack: stack})
+	}
+
+	runtimex.LogFatalOnError0(os.MkdirAll(outputFlag, 0755))
+	restoreShaping := runtimex.LogFatalOnError1(netProfileShape(nameFlag, netProfileFlag))
+	defer restoreShaping()
+	manifest := &sweepManifest{Args: args, Shaping: shapeLoad(nameFlag), Time: time.Now()}
+
+	// Generate certs for the server's IP and push them to both nodes.
+	tb := backendFor(nameFlag)
+	mustRun("go build -v ./cmd/gencert")
+	mustRun("./gencert --ip-addr %s", serverAddr)
+	tb.Push(nameFlag, "client", "testdata/cert.pem")
+	tb.Push(nameFlag, "server", "testdata/cert.pem")
+	tb.Push(nameFlag, "server", "testdata/key.pem")
+
+	if iperfFlag {
+		for repetition := range warmupFlag + repeatFlag {
+			for _, method := range methodsFlag {
+				entry := &sweepRun{
+					ID:         sweepRunID(len(manifest.Runs), "iperf3", method, false, repetition),
+					Method:     method,
+					Repetition: repetition,
+					Stack:      "iperf3",
+					Warmup:     repetition < warmupFlag,
+				}
+				sweepIperf(tb, nameFlag, outputFlag, durationFlag, entry)
+				manifest.Runs = append(manifest.Runs, entry)
+				sweepWriteManifest(outputFlag, manifest)
+			}
+		}
+	}
+
+	programs := map[string]string{}
+	for _, spec := range specs {
+		if programs[spec.name] == "" {
+			programs[spec.name] = sweepDeploy(tb, nameFlag, spec.name)
+		}
+
+		for _, tls := range tlsModes {
+			if !slices.Contains(spec.stack.tls, tls) {
+				continue
+			}
+			serverProfile := ""
+			if profileFlag && spec.stack.profile {
+				serverProfile = fmt.Sprintf("%03d-%s-server", len(manifest.Runs), spec.name)
+			}
+			server := sweepStartServer(tb, nameFlag, programs[spec.name], spec.name, tls, serverProfile)
+
+			for repetition := range warmupFlag + repeatFlag {
+				for _, method := range methodsFlag {
+					if spec.stack.getOnly && method != "GET" {
+						continue
+					}
+					entry := &sweepRun{
+						Flags:      spec.flags,
+						ID:         sweepRunID(len(manifest.Runs), spec.name, method, tls, repetition),
+						Method:     method,
+						Repetition: repetition,
+						Stack:      spec.name,
+						TLS:        tls,
+						Warmup:     repetition < warmupFlag,
+					}
+					sweepMeasure(tb, nameFlag, programs[spec.name], outputFlag, durationFlag, profileFlag, spec.stack, entry)
+					manifest.Runs = append(manifest.Runs, entry)
+					sweepWriteManifest(outputFlag, manifest)
+				}
+			}
+
+			sweepStopServer(tb, nameFlag, spec.name, server)
+			if serverProfile != "" {
+				profilePull(tb, nameFlag, "server", serverProfile, outputFlag)
+			}
+		}
+	}
+
+	sweepWriteManifest(outputFlag, manifest)
+	return nil
+}
+
+// sweepDeploy builds the stack, makes it available to both nodes, and
+// returns the path to use for running it, which is the same for both.
+func sweepDeploy(tb backend, name, stack string) string {
+	if stack == "rusthttp2" {
+		mustRun("cargo build --release --target x86_64-unknown-linux-musl --manifest-path cmd/rusthttp2/Cargo.toml")
+		mustRun("cp cmd/rusthttp2/target/x86_64-unknown-linux-musl/release/rusthttp2 .")
+	} else {
+		mustRun("go build -v ./cmd/%s", stack)
+	}
+	tb.Program(name, "client", stack)
+	return tb.Program(name, "server", stack)
+}
+
+// sweepStartServer starts the stack server in the background, collecting
+// profiles using the given prefix unless it is empty.
+func sweepStartServer(tb backend, name, program, stack string, tls bool, profile string) *exec.Cmd {
+	// Kill leftovers from interrupted sweeps, ignoring the "no process found" error.
+	_ = tb.Kill(name, "server", stack)
+
+	cmdArgv := tb.Exec(name, "server", program, "serve", "-A", serverAddr)
+	if (stack == "rusthttp2" || stack == "ndt7") && !tls {
+		cmdArgv = append(cmdArgv, "--no-tls")
+	}
+	if profile != "" {
+		cmdArgv = append(cmdArgv, profileArgs(profile)...)
+	}
+	cmd := runtimex.LogFatalOnError1(command("%s", shellquote.Join(cmdArgv...)))
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	runtimex.LogFatalOnError0(cmd.Start())
+
+	time.Sleep(sweepStartupDelay)
+	return cmd
+}
+
+// sweepStopServer stops the server started by [sweepStartServer].
+func sweepStopServer(tb backend, name, stack string, server *exec.Cmd) {
+	runtimex.LogFatalOnError0(tb.Kill(name, "server", stack))
+	_ = server.Wait() // the server exits because of the signal
+}
+
+// sweepMeasure runs measure, collects its output into dir, and updates entry.
+func sweepMeasure(tb backend, name, program, dir, duration string, profile bool, stack *sweepStack, entry *sweepRun) {
+	cmdArgv := tb.Exec(name, "client", program, "measure", "-A", serverAddr)
+	if !stack.getOnly {
+		cmdArgv = append(cmdArgv, "-X", entry.Method)
+	}
+	if (entry.Stack == "rusthttp2" || entry.Stack == "ndt7") && !entry.TLS {
+		cmdArgv = append(cmdArgv, "--no-tls")
+	}
+	if stack.duration && duration != "" {
+		cmdArgv = append(cmdArgv, "-d", duration)
+	}
+	if stack.output {
+		// Make sure we do not collect a stale report if measure fails early.
+		mustRunArgv(tb.Exec(name, "client", "rm", "-f", sweepReportFile)...)
+		cmdArgv = append(cmdArgv, "--output", sweepReportFile)
+	}
+	if profile && stack.profile {
+		cmdArgv = append(cmdArgv, profileArgs(entry.ID+"-client")...)
+	}
+	cmdArgv = append(cmdArgv, entry.Flags...)
+
+	entry.Log = entry.ID + ".log"
+	logfile := runtimex.LogFatalOnError1(os.Create(filepath.Join(dir, entry.Log)))
+	defer logfile.Close()
+	if err := runTee(logfile, "%s", shellquote.Join(cmdArgv...)); err != nil {
+		entry.Failure = err.Error()
+	}
+
+	if stack.output {
+		report := entry.ID + ".json"
+		if err := tb.Pull(name, "client", sweepReportFile, filepath.Join(dir, report)); err == nil {
+			entry.Report = report
+		}
+	}
+	if profile && stack.profile {
+		profilePull(tb, name, "client", entry.ID+"-client", dir)
+	}
+}
+
+// sweepIperf runs iperf3 against the server started by [createMain],
+// saves its JSON output into dir, and updates entry.
+func sweepIperf(tb backend, name, dir, duration string, entry *sweepRun) {
+	cmdArgv := tb.Exec(name, "client", "iperf3", "-c", serverAddr, "--json")
+	if entry.Method == "GET" {
+		cmdArgv = append(cmdArgv, "-R") // the server sends, so we download
+	}
+	if duration != "" {
+		seconds := runtimex.LogFatalOnError1(time.ParseDuration(duration)).Seconds()
+		cmdArgv = append(cmdArgv, "-t", strconv.Itoa(max(int(seconds), 1)))
+	}
+
+	entry.Log = entry.ID + ".log"
+	logfile := runtimex.LogFatalOnError1(os.Create(filepath.Join(dir, entry.Log)))
+	defer logfile.Close()
+	entry.Report = entry.ID + ".json"
+	reportfile := runtimex.LogFatalOnError1(os.Create(filepath.Join(dir, entry.Report)))
+	defer reportfile.Close()
+
+	cmd := runtimex.LogFatalOnError1(command("%s", shellquote.Join(cmdArgv...)))
+	cmd.Stdout = reportfile
+	cmd.Stderr = io.MultiWriter(os.Stderr, logfile)
+	if err := cmd.Run(); err != nil {
+		entry.Failure = err.Error()
+	}
+}
+
+// sweepRunID returns the ID of a run, which we also use to name its files.
+func sweepRunID(index int, stack, method string, tls bool, repetition int) string {
+	mode := "notls"
+	if tls {
+		mode = "tls"
+	}
+	return fmt.Sprintf("%03d-%s-%s-%s-%d", index, stack, strings.ToLower(method), mode, repetition)
+}
+
+// sweepWriteManifest writes the manifest into dir.
+func sweepWriteManifest(dir string, manifest *sweepManifest) {
+	data := runtimex.PanicOnError1(json.MarshalIndent(manifest, "", "  "))
+	runtimex.LogFatalOnError0(os.WriteFile(filepath.Join(dir, "sweep.json"), append(data, '\n'), 0600))
+}
@@ -4,45 +4,174 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"os"
+	"slices"
 
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
 )
 
 func measureMain(ctx context.Context, args []string) error {
 	var (
-		addressFlag = "127.0.0.1"
-		methodFlag  = "GET"
-		portFlag    = "4567"
+		addressFlag    = "127.0.0.1"
+		certFlag       = "cert.pem"
+		methodFlag     = "GET"
+		noTLSFlag      = false
+		outputFlag     = ""
+		portFlag       = "4567"
+		repeatFlag     = 1
+		tlsCipherFlag  = []string{}
+		tlsVersionFlag = ""
+		warmupFlag     = 0
 	)
 
 	fset := vflag.NewFlagSet("ndt7 measure", vflag.ExitOnError)
 	fset.StringVar(&addressFlag, 'A', "address", "Use the given IP `ADDRESS`.")
+	fset.StringVar(&certFlag, 0, "cert", "Use `FILE` as the CA certificate.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&methodFlag, 'X', "method", "Use `METHOD` (GET for download, PUT for upload).")
+	fset.BoolVar(&noTLSFlag, 0, "no-tls", "Use WebSocket over cleartext (ws://).")
+	fset.StringVar(&outputFlag, 0, "output", "Write JSON results to `FILE`.")
 	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	fset.IntVar(&repeatFlag, 0, "repeat", "Repeat the measurement `N` times.")
+	fset.StringSliceVar(&tlsCipherFlag, 0, "tls-cipher", "Offer the given TLS 1.2 cipher `SUITE` (e.g., TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256).")
+	fset.StringVar(&tlsVersionFlag, 0, "tls-version", "Only use the given TLS `VERSION` (1.2, 1.3).")
+	fset.IntVar(&warmupFlag, 0, "warmup", "Run and discard `N` warm-up measurements first.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
 	runtimex.PanicOnError0(fset.Parse(args))
 
 	runtimex.Assert(methodFlag == "GET" || methodFlag == "PUT")
+	runtimex.Assert(repeatFlag >= 1 && warmupFlag >= 0)
+	runtimex.Assert(certFlag != "")
 
-	host := net.JoinHostPort(addressFlag, portFlag)
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
 
-	if methodFlag == "GET" {
-		wsURL := fmt.Sprintf("wss://%s/ndt/v7/download", host)
-		slog.Info("download", slog.String("url", wsURL))
-		conn, err := dial(ctx, wsURL, true)
-		runtimex.LogFatalOnError0(err)
-		receiver(ctx, conn, "download")
-	} else {
-		wsURL := fmt.Sprintf("wss://%s/ndt/v7/upload", host)
-		slog.Info("upload", slog.String("url", wsURL))
-		conn, err := dial(ctx, wsURL, true)
-		runtimex.LogFatalOnError0(err)
-		sender(ctx, conn, "upload")
+	config := &measureConfig{
+		Host:   net.JoinHostPort(addressFlag, portFlag),
+		Link:   runtimex.LogFatalOnError1(emulation.Config()),
+		Method: methodFlag,
+	}
+	if !noTLSFlag {
+		config.TLSConfig = runtimex.LogFatalOnError1(newTLSConfig(certFlag, tlsVersionFlag, tlsCipherFlag))
 	}
+	results := bench.Repeat(warmupFlag, repeatFlag, func() *bench.Result {
+		return measureOnce(ctx, config)
+	})
+	result := results[len(results)-1]
+	if outputFlag != "" {
+		runtimex.LogFatalOnError0(bench.NewReport("ndt7", args, results...).WriteFile(outputFlag))
+	}
+	stopProfiling() // LogFatalOnError0 does not run the deferred calls
+	runtimex.LogFatalOnError0(result.Err)
 
 	return nil
 }
+
+// newTLSConfig returns the [*tls.Config] trusting the CA in certFile and
+// restricted to the given TLS version and cipher suites, unless empty.
+func newTLSConfig(certFile, version string, ciphers []string) (*tls.Config, error) {
+	caCert, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(caCert) {
+		return nil, fmt.Errorf("no certificates in %s", certFile)
+	}
+	config := &tls.Config{RootCAs: caPool}
+
+	switch version {
+	case "":
+	case "1.2":
+		config.MinVersion, config.MaxVersion = tls.VersionTLS12, tls.VersionTLS12
+	case "1.3":
+		config.MinVersion, config.MaxVersion = tls.VersionTLS13, tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported TLS version %q", version)
+	}
+
+	// Go does not allow choosing the TLS 1.3 cipher suites.
+	if len(ciphers) > 0 && version != "1.2" {
+		return nil, errors.New("choosing the cipher suites requires TLS 1.2")
+	}
+	for _, name := range ciphers {
+		idx := slices.IndexFunc(tls.CipherSuites(), func(suite *tls.CipherSuite) bool {
+			return suite.Name == name
+		})
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown TLS cipher suite %q", name)
+		}
+		config.CipherSuites = append(config.CipherSuites, tls.CipherSuites()[idx].ID)
+	}
+	return config, nil
+}
+
+// measureConfig configures [measureOnce].
+type measureConfig struct {
+	// Host is the server endpoint.
+	Host string
+
+	// Link, if not nil, is the emulated link.
+	Link *linkemu.Config
+
+	// Method is GET for download and PUT for upload.
+	Method string
+
+	// TLSConfig is the TLS configuration or nil to use cleartext.
+	TLSConfig *tls.Config
+}
+
+// measureOnce runs a single download (GET) or upload (PUT) test.
+func measureOnce(ctx context.Context, config *measureConfig) *bench.Result {
+	method := config.Method
+	testname := "download"
+	if method == "PUT" {
+		testname = "upload"
+	}
+	scheme := "wss"
+	if config.TLSConfig == nil {
+		scheme = "ws"
+	}
+	wsURL := fmt.Sprintf("%s://%s/ndt/v7/%s", scheme, config.Host, testname)
+	slog.Info(testname, slog.String("url", wsURL))
+	conn, resp, err := dial(ctx, wsURL, config.TLSConfig, config.Link)
+	if err != nil {
+		return &bench.Result{Err: err, Method: method, URL: wsURL}
+	}
+	defer conn.Close()
+
+	var result *bench.Result
+	if method == "GET" {
+		result = receiver(ctx, conn, originClient, testname)
+	} else {
+		result = sender(ctx, conn, originClient, testname)
+	}
+	result.Method = method
+	result.Proto = resp.Proto
+	result.URL = wsURL
+	if tlsConn, ok := conn.NetConn().(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		result.ALPN = state.NegotiatedProtocol
+		slog.Info("tls",
+			slog.String("version", tls.VersionName(state.Version)),
+			slog.String("cipher", tls.CipherSuiteName(state.CipherSuite)),
+		)
+	}
+	if result.Server != nil {
+		result.Server.Log()
+	}
+	return result
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+	"github.com/bassosimone/2026-02-http2-perf/internal/tcpinfo"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// originClient is the [measurement] Origin of the client.
+	originClient = "client"
+
+	// originServer is the [measurement] Origin of the server.
+	originServer = "server"
+)
+
+// measurement is the ndt7 Measurement message, which both peers send as a
+// text message every measureInterval. See the ndt7 specification at
+// https://github.com/m-lab/ndt-server/blob/main/spec/ndt7-protocol.md.
+//
+// All the times are in microseconds, like in the specification.
+type measurement struct {
+	AppInfo        *appInfo        `json:",omitempty"`
+	BBRInfo        *bbrInfo        `json:",omitempty"`
+	ConnectionInfo *connectionInfo `json:",omitempty"`
+	Origin         string          `json:",omitempty"`
+	TCPInfo        *tcpInfo        `json:",omitempty"`
+	Test           string          `json:",omitempty"`
+}
+
+// appInfo contains the application-level measurement.
+type appInfo struct {
+	ElapsedTime int64
+	NumBytes    int64
+}
+
+// bbrInfo contains the BBR state, when the sender uses BBR.
+type bbrInfo struct {
+	BW          int64
+	CwndGain    int64
+	ElapsedTime int64
+	MinRTT      int64
+	PacingGain  int64
+}
+
+// connectionInfo describes the connection, which we only send once.
+type connectionInfo struct {
+	Client string
+	Server string
+}
+
+// tcpInfo contains the subset of the TCP_INFO fields that [tcpinfo.Sample]
+// collects, using the names of the M-Lab implementation.
+type tcpInfo struct {
+	BusyTime      int64
+	BytesAcked    int64
+	BytesReceived int64
+	BytesRetrans  int64
+	BytesSent     int64
+	DeliveryRate  int64
+	ElapsedTime   int64
+	MinRTT        int64
+	NotsentBytes  int64
+	PacingRate    int64
+	RTT           int64
+	RTTVar        int64
+	RWndLimited   int64
+	SndBufLimited int64
+	SndCwnd       int64
+	SndMSS        int64
+	SndWnd        int64
+	TotalRetrans  int64
+}
+
+// measurer creates the measurements we send to the peer.
+type measurer struct {
+	conn     *websocket.Conn
+	origin   string
+	sentInfo bool
+	start    time.Time
+	test     string
+}
+
+// newMeasurer constructs a new [*measurer] for the given test.
+func newMeasurer(conn *websocket.Conn, origin, test string, start time.Time) *measurer {
+	return &measurer{conn: conn, origin: origin, start: start, test: test}
+}
+
+// measure returns the current [*measurement] given the bytes transferred.
+func (m *measurer) measure(count int64) *measurement {
+	elapsed := time.Since(m.start).Microseconds()
+	msg := &measurement{
+		AppInfo: &appInfo{ElapsedTime: elapsed, NumBytes: count},
+		Origin:  m.origin,
+		Test:    m.test,
+	}
+	if !m.sentInfo {
+		msg.ConnectionInfo = m.connectionInfo()
+		m.sentInfo = true
+	}
+	sample, err := tcpinfo.Get(m.conn.NetConn())
+	if err != nil {
+		return msg // e.g., not on Linux
+	}
+	msg.TCPInfo = newTCPInfo(sample, elapsed)
+	if sample.BBR != nil {
+		msg.BBRInfo = &bbrInfo{
+			BW:          int64(sample.BBR.BW),
+			CwndGain:    int64(sample.BBR.CwndGain),
+			ElapsedTime: elapsed,
+			MinRTT:      sample.BBR.MinRTT.Microseconds(),
+			PacingGain:  int64(sample.BBR.PacingGain),
+		}
+	}
+	return msg
+}
+
+// connectionInfo returns the [*connectionInfo] from our point of view.
+func (m *measurer) connectionInfo() *connectionInfo {
+	local, remote := m.conn.LocalAddr(), m.conn.RemoteAddr()
+	if m.origin == originClient {
+		return &connectionInfo{Client: local.String(), Server: remote.String()}
+	}
+	return &connectionInfo{Client: remote.String(), Server: local.String()}
+}
+
+// newTCPInfo converts a [*tcpinfo.Sample] to a [*tcpInfo].
+func newTCPInfo(sample *tcpinfo.Sample, elapsed int64) *tcpInfo {
+	return &tcpInfo{
+		BusyTime:      sample.BusyTime.Microseconds(),
+		BytesAcked:    int64(sample.BytesAcked),
+		BytesReceived: int64(sample.BytesReceived),
+		BytesRetrans:  int64(sample.BytesRetrans),
+		BytesSent:     int64(sample.BytesSent),
+		DeliveryRate:  int64(sample.DeliveryRate),
+		ElapsedTime:   elapsed,
+		MinRTT:        sample.MinRTT.Microseconds(),
+		NotsentBytes:  int64(sample.NotsentBytes),
+		PacingRate:    int64(sample.PacingRate),
+		RTT:           sample.RTT.Microseconds(),
+		RTTVar:        sample.RTTVar.Microseconds(),
+		RWndLimited:   sample.RwndLimited.Microseconds(),
+		SndBufLimited: sample.SndbufLimited.Microseconds(),
+		SndCwnd:       int64(sample.SndCwnd),
+		SndMSS:        int64(sample.SndMSS),
+		SndWnd:        int64(sample.SndWnd),
+		TotalRetrans:  int64(sample.TotalRetrans),
+	}
+}
+
+// writeMeasurement sends the [*measurement] to the peer.
+func writeMeasurement(conn *websocket.Conn, msg *measurement) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// readMeasurements reads the measurements the receiver sends while we are
+// sending until reading fails and returns the last server-side view of the
+// transfer, if any.
+func readMeasurements(conn *websocket.Conn) (server *bench.ServerResult) {
+	conn.SetReadLimit(maxMessageSize)
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if kind != websocket.TextMessage {
+			continue
+		}
+		if result := parseMeasurement(data); result != nil {
+			server = result
+		}
+	}
+}
+
+// parseMeasurement parses and logs a measurement sent by the peer and returns
+// the server-side view of the transfer when the peer is the server.
+func parseMeasurement(data []byte) *bench.ServerResult {
+	var msg measurement
+	if err := json.Unmarshal(data, &msg); err != nil {
+		slog.Warn("cannot parse the peer measurement", slog.Any("err", err))
+		return nil
+	}
+	if msg.AppInfo == nil {
+		return nil
+	}
+	elapsed := time.Duration(msg.AppInfo.ElapsedTime) * time.Microsecond
+	args := []any{
+		slog.String("origin", msg.Origin),
+		slog.String("test", msg.Test),
+		slog.String("bytes", humanize.IEC(float64(msg.AppInfo.NumBytes), "B")),
+		slog.String("elapsed", elapsed.Truncate(time.Millisecond).String()),
+	}
+	if msg.TCPInfo != nil {
+		args = append(args, slog.Duration("rtt", time.Duration(msg.TCPInfo.RTT)*time.Microsecond))
+	}
+	slog.Info("measurement", args...)
+	if msg.Origin != originServer {
+		return nil
+	}
+	return bench.NewServerResult(msg.AppInfo.NumBytes, elapsed)
+}
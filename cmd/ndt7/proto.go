@@ -6,13 +6,18 @@ import (
 	"context"
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/bassosimone/2026-02-http2-perf/internal/bench"
+	"github.com/bassosimone/2026-02-http2-perf/internal/cpuusage"
 	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/2026-02-http2-perf/internal/tcpinfo"
 	"github.com/gorilla/websocket"
 )
 
@@ -39,19 +44,41 @@ const (
 	wsProto = "net.measurementlab.ndt.v7"
 )
 
-// emitAppInfo logs a local measurement using slog.
-func emitAppInfo(start time.Time, total int64, testname string) {
-	elapsed := time.Since(start).Seconds()
+// emitAppInfo logs a local measurement using slog and records it
+// as a sample inside the given result.
+func emitAppInfo(result *bench.Result, testname string) {
+	now := time.Now()
+	elapsed := now.Sub(result.Start)
 	var speed float64
 	if elapsed > 0 {
-		speed = float64(total) * 8 / elapsed
+		speed = float64(result.Bytes) * 8 / elapsed.Seconds()
 	}
 	slog.Info(testname,
 		slog.String("test", testname),
-		slog.String("bytes", humanize.IEC(float64(total), "B")),
-		slog.String("elapsed", time.Since(start).Truncate(time.Millisecond).String()),
+		slog.String("bytes", humanize.IEC(float64(result.Bytes), "B")),
+		slog.String("elapsed", elapsed.Truncate(time.Millisecond).String()),
 		slog.String("speed", humanize.SI(speed, "bit/s")),
 	)
+	sample := slogging.Sample{Elapsed: elapsed, Interval: elapsed, Time: now, Total: result.Bytes}
+	if count := len(result.Samples); count > 0 {
+		prev := result.Samples[count-1]
+		sample.Interval = elapsed - prev.Elapsed
+		sample.Delta = result.Bytes - prev.Total
+	} else {
+		sample.Delta = result.Bytes
+	}
+	result.Samples = append(result.Samples, sample)
+}
+
+// ignoreDeadline maps reaching the maxRuntime deadline, which is
+// how a test normally terminates, to a nil error. We cannot use
+// [os.ErrDeadlineExceeded] because gorilla/websocket does not wrap it.
+func ignoreDeadline(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return nil
+	}
+	return err
 }
 
 // newMessage creates a prepared WebSocket binary message of the given size.
@@ -59,12 +86,30 @@ func newMessage(n int) (*websocket.PreparedMessage, error) {
 	return websocket.NewPreparedMessage(websocket.BinaryMessage, make([]byte, n))
 }
 
-// sender writes binary WebSocket messages with adaptive sizing. Used by
+// sender writes binary WebSocket messages with adaptive sizing, as well
+// as our measurements, while reading the receiver's measurements. Used by
 // the server for download and by the client for upload.
-func sender(ctx context.Context, conn *websocket.Conn, testname string) error {
-	var total int64
-	start := time.Now()
-	if err := conn.SetWriteDeadline(start.Add(maxRuntime)); err != nil {
+func sender(ctx context.Context, conn *websocket.Conn, origin, testname string) *bench.Result {
+	meter := cpuusage.Start()
+	result := &bench.Result{Start: time.Now()}
+	sampler := tcpinfo.Start(conn.NetConn(), measureInterval)
+	peer := make(chan *bench.ServerResult, 1)
+	go func() {
+		peer <- readMeasurements(conn)
+	}()
+	result.Err = ignoreDeadline(senderLoop(ctx, conn, newMeasurer(conn, origin, testname, result.Start), result))
+	result.Elapsed = time.Since(result.Start)
+	// Give the receiver's last measurement a chance to arrive.
+	_ = conn.SetReadDeadline(time.Now().Add(measureInterval))
+	result.Server = <-peer
+	result.TCPInfo = sampler.Stop()
+	result.CPU = meter.Stop()
+	result.CPU.Log("cpu", result.Bytes)
+	return result
+}
+
+func senderLoop(ctx context.Context, conn *websocket.Conn, m *measurer, result *bench.Result) error {
+	if err := conn.SetWriteDeadline(result.Start.Add(maxRuntime)); err != nil {
 		return err
 	}
 	size := minMessageSize
@@ -78,13 +123,16 @@ func sender(ctx context.Context, conn *websocket.Conn, testname string) error {
 		if err := conn.WritePreparedMessage(message); err != nil {
 			return err
 		}
-		total += int64(size)
+		result.Bytes += int64(size)
 		select {
 		case <-ticker.C:
-			emitAppInfo(start, total, testname)
+			emitAppInfo(result, m.test)
+			if err := writeMeasurement(conn, m.measure(result.Bytes)); err != nil {
+				return err
+			}
 		default:
 		}
-		if int64(size) >= maxScaledMessageSize || int64(size) >= (total/fractionForScaling) {
+		if int64(size) >= maxScaledMessageSize || int64(size) >= (result.Bytes/fractionForScaling) {
 			continue
 		}
 		size <<= 1
@@ -95,13 +143,26 @@ func sender(ctx context.Context, conn *websocket.Conn, testname string) error {
 	return nil
 }
 
-// receiver reads WebSocket messages and discards binary data.
-// Text messages (server-side measurements) are printed to stdout.
-// Used by the client for download and by the server for upload.
-func receiver(ctx context.Context, conn *websocket.Conn, testname string) error {
-	var total int64
-	start := time.Now()
-	if err := conn.SetReadDeadline(start.Add(maxRuntime)); err != nil {
+// receiver reads WebSocket messages and discards binary data, logs the
+// sender's measurements, and sends our measurements. Used by the client
+// for download and by the server for upload.
+func receiver(ctx context.Context, conn *websocket.Conn, origin, testname string) *bench.Result {
+	meter := cpuusage.Start()
+	result := &bench.Result{Start: time.Now()}
+	sampler := tcpinfo.Start(conn.NetConn(), measureInterval)
+	result.Err = ignoreDeadline(receiverLoop(ctx, conn, newMeasurer(conn, origin, testname, result.Start), result))
+	result.Elapsed = time.Since(result.Start)
+	result.TCPInfo = sampler.Stop()
+	result.CPU = meter.Stop()
+	result.CPU.Log("cpu", result.Bytes)
+	return result
+}
+
+func receiverLoop(ctx context.Context, conn *websocket.Conn, m *measurer, result *bench.Result) error {
+	if err := conn.SetReadDeadline(result.Start.Add(maxRuntime)); err != nil {
+		return err
+	}
+	if err := conn.SetWriteDeadline(result.Start.Add(maxRuntime)); err != nil {
 		return err
 	}
 	conn.SetReadLimit(maxMessageSize)
@@ -117,18 +178,23 @@ func receiver(ctx context.Context, conn *websocket.Conn, testname string) error
 			if err != nil {
 				return err
 			}
-			total += int64(len(data))
-			fmt.Printf("%s\n", string(data))
+			result.Bytes += int64(len(data))
+			if server := parseMeasurement(data); server != nil {
+				result.Server = server
+			}
 			continue
 		}
 		n, err := io.Copy(io.Discard, reader)
 		if err != nil {
 			return err
 		}
-		total += n
+		result.Bytes += n
 		select {
 		case <-ticker.C:
-			emitAppInfo(start, total, testname)
+			emitAppInfo(result, m.test)
+			if err := writeMeasurement(conn, m.measure(result.Bytes)); err != nil {
+				return err
+			}
 		default:
 		}
 	}
@@ -150,19 +216,16 @@ func upgrade(rw http.ResponseWriter, req *http.Request) (*websocket.Conn, error)
 	return u.Upgrade(rw, req, h)
 }
 
-// dial connects to a WebSocket endpoint on the client side.
-func dial(ctx context.Context, wsURL string, insecure bool) (*websocket.Conn, error) {
+// dial connects to a WebSocket endpoint on the client side, using tlsConfig
+// for wss:// URLs, and sending through the emulated link unless link is nil.
+func dial(ctx context.Context, wsURL string, tlsConfig *tls.Config, link *linkemu.Config) (*websocket.Conn, *http.Response, error) {
 	dialer := websocket.Dialer{
+		NetDialContext:  link.DialContext((&net.Dialer{}).DialContext),
 		ReadBufferSize:  maxMessageSize,
+		TLSClientConfig: tlsConfig,
 		WriteBufferSize: maxMessageSize,
 	}
-	if insecure {
-		dialer.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-	}
 	headers := http.Header{}
 	headers.Add("Sec-WebSocket-Protocol", wsProto)
-	conn, _, err := dialer.DialContext(ctx, wsURL, headers)
-	return conn, err
+	return dialer.DialContext(ctx, wsURL, headers)
 }
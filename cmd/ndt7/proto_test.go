@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// benchChunk is the number of bytes transferred by each benchmark operation.
+const benchChunk = 1 << 20
+
+func TestMain(m *testing.M) {
+	// The tests log their progress, which would drown the benchmark output.
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	os.Exit(m.Run())
+}
+
+// BenchmarkLoopback measures ndt7 on the loopback using the same handlers
+// and client code as the serve and measure commands:
+//
+//	go test -run '^$' -bench Loopback ./cmd/ndt7
+//
+// Since ndt7 tests are time bounded, we stop the client once the server
+// connection has transferred [benchChunk] bytes per operation, including
+// the TLS and WebSocket overhead.
+func BenchmarkLoopback(b *testing.B) {
+	for _, method := range []string{"GET", "PUT"} {
+		b.Run(method, func(b *testing.B) {
+			ctx, cancel := context.WithCancel(b.Context())
+			defer cancel()
+
+			srv := httptest.NewUnstartedServer(newHandler())
+			srv.Listener = &benchListener{
+				Listener: srv.Listener,
+				cancel:   cancel,
+				target:   int64(b.N) * benchChunk,
+			}
+			srv.StartTLS()
+			b.Cleanup(srv.Close)
+
+			b.SetBytes(benchChunk)
+			b.ReportAllocs()
+			b.ResetTimer()
+			result := measureOnce(ctx, &measureConfig{
+				Host:      srv.Listener.Addr().String(),
+				Method:    method,
+				TLSConfig: srv.Client().Transport.(*http.Transport).TLSClientConfig,
+			})
+			b.StopTimer()
+			if result.Err != nil {
+				b.Fatal(result.Err)
+			}
+		})
+	}
+}
+
+// benchListener is a [net.Listener] calling cancel once its connections
+// have read or written the target number of bytes.
+type benchListener struct {
+	net.Listener
+	cancel context.CancelFunc
+	count  atomic.Int64
+	target int64
+}
+
+// Accept implements [net.Listener].
+func (l *benchListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &benchConn{Conn: conn, listener: l}, nil
+}
+
+// add accounts for n bytes read or written.
+func (l *benchListener) add(n int) {
+	if l.count.Add(int64(n)) >= l.target {
+		l.cancel()
+	}
+}
+
+// benchConn is a [net.Conn] accepted by [*benchListener].
+type benchConn struct {
+	net.Conn
+	listener *benchListener
+}
+
+// Read implements [net.Conn].
+func (c *benchConn) Read(data []byte) (int, error) {
+	count, err := c.Conn.Read(data)
+	c.listener.add(count)
+	return count, err
+}
+
+// Write implements [net.Conn].
+func (c *benchConn) Write(data []byte) (int, error) {
+	count, err := c.Conn.Write(data)
+	c.listener.add(count)
+	return count, err
+}
@@ -9,6 +9,8 @@ import (
 	"net"
 	"net/http"
 
+	"github.com/bassosimone/2026-02-http2-perf/internal/linkemu"
+	"github.com/bassosimone/2026-02-http2-perf/internal/profiling"
 	"github.com/bassosimone/runtimex"
 	"github.com/bassosimone/vflag"
 )
@@ -18,6 +20,7 @@ func serveMain(ctx context.Context, args []string) error {
 		addressFlag = "127.0.0.1"
 		certFlag    = "cert.pem"
 		keyFlag     = "key.pem"
+		noTLSFlag   = false
 		portFlag    = "4567"
 	)
 
@@ -26,36 +29,34 @@ func serveMain(ctx context.Context, args []string) error {
 	fset.StringVar(&certFlag, 0, "cert", "Use `FILE` as the TLS certificate.")
 	fset.AutoHelp('h', "help", "Print this help text and exit.")
 	fset.StringVar(&keyFlag, 0, "key", "Use `FILE` as the TLS private key.")
+	fset.BoolVar(&noTLSFlag, 0, "no-tls", "Serve WebSocket over cleartext (ws://).")
 	fset.StringVar(&portFlag, 'p', "port", "Use the given TCP `PORT`.")
+	emulation := &linkemu.Flags{}
+	emulation.AddFlags(fset)
+	profile := &profiling.Flags{}
+	profile.AddFlags(fset)
 	runtimex.PanicOnError0(fset.Parse(args))
 
-	mux := http.NewServeMux()
-	mux.HandleFunc("/ndt/v7/download", func(rw http.ResponseWriter, req *http.Request) {
-		conn, err := upgrade(rw, req)
-		if err != nil {
-			return
-		}
-		slog.Info("download", slog.String("remote", req.RemoteAddr))
-		sender(req.Context(), conn, "download")
-	})
-	mux.HandleFunc("/ndt/v7/upload", func(rw http.ResponseWriter, req *http.Request) {
-		conn, err := upgrade(rw, req)
-		if err != nil {
-			return
-		}
-		slog.Info("upload", slog.String("remote", req.RemoteAddr))
-		receiver(req.Context(), conn, "upload")
-	})
+	stopProfiling := runtimex.LogFatalOnError1(profile.Start())
+	defer stopProfiling()
+
+	link := runtimex.LogFatalOnError1(emulation.Config())
 
 	endpoint := net.JoinHostPort(addressFlag, portFlag)
-	srv := &http.Server{Addr: endpoint, Handler: mux}
+	srv := &http.Server{Addr: endpoint, Handler: newHandler()}
 	go func() {
 		defer srv.Close()
 		<-ctx.Done()
 	}()
 
 	slog.Info("serving at", slog.String("addr", endpoint))
-	err := srv.ListenAndServeTLS(certFlag, keyFlag)
+	listener := link.Listener(runtimex.LogFatalOnError1(net.Listen("tcp", endpoint)))
+	var err error
+	if noTLSFlag {
+		err = srv.Serve(listener)
+	} else {
+		err = srv.ServeTLS(listener, certFlag, keyFlag)
+	}
 	slog.Info("interrupted", slog.Any("err", err))
 
 	if errors.Is(err, http.ErrServerClosed) {
@@ -64,3 +65,25 @@ func serveMain(ctx context.Context, args []string) error {
 	runtimex.LogFatalOnError0(err)
 	return nil
 }
+
+// newHandler returns the [http.Handler] serving the ndt7 download and upload tests.
+func newHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ndt/v7/download", func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := upgrade(rw, req)
+		if err != nil {
+			return
+		}
+		slog.Info("download", slog.String("remote", req.RemoteAddr))
+		sender(req.Context(), conn, originServer, "download")
+	})
+	mux.HandleFunc("/ndt/v7/upload", func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := upgrade(rw, req)
+		if err != nil {
+			return
+		}
+		slog.Info("upload", slog.String("remote", req.RemoteAddr))
+		receiver(req.Context(), conn, originServer, "upload")
+	})
+	return mux
+}
@@ -0,0 +1,404 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package bench implements the HTTP client transfer loop and the HTTP
+// handlers shared by the gohttp1, gohttp2 and gohttp2c commands.
+package bench
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/cpuusage"
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+	"github.com/bassosimone/2026-02-http2-perf/internal/infinite"
+	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/2026-02-http2-perf/internal/tcpinfo"
+)
+
+// Config contains the [Run] configuration.
+type Config struct {
+	// Bytes is the number of bytes to transfer.
+	Bytes int64
+
+	// Connections is the number of parallel connections to use, each
+	// using its own transport returned by NewTransport. If zero, we
+	// use a single connection.
+	Connections int
+
+	// Duration, when positive, bounds the transfer by time rather
+	// than by size, in which case Bytes is ignored. The servers reject
+	// durations longer than [MaxDuration].
+	Duration time.Duration
+
+	// Host is the server endpoint using the host:port format.
+	Host string
+
+	// Interval is the interval between samples. If zero, we
+	// use [slogging.DefaultInterval].
+	Interval time.Duration
+
+	// Method is the HTTP method to use (GET or PUT).
+	Method string
+
+	// Scheme is the URL scheme to use (http or https).
+	Scheme string
+
+	// NewTransport returns a new [http.RoundTripper] for each connection.
+	NewTransport func() http.RoundTripper
+
+	// ProbeInterval, when positive, is the interval between responsiveness
+	// probes, which we send during the transfers over a separate connection.
+	// If the transport implements [Pinger], i.e., with HTTP/2, we also send
+	// probes over the connection used by the first transfer, as well as
+	// HTTP/2 PING frames over both connections.
+	ProbeInterval time.Duration
+
+	// Streams is the number of concurrent transfers to run on each
+	// connection, each transferring Bytes or lasting Duration. With
+	// HTTP/2, these become streams sharing a single connection. If
+	// zero, we run a single transfer.
+	Streams int
+
+	// Trailers, when true, asks the server to send its measurements as
+	// trailers in response to GET using `TE: trailers`, which, with
+	// HTTP/1.1, means using chunked encoding instead of Content-Length.
+	Trailers bool
+}
+
+// Result contains the results of [Run].
+type Result struct {
+	// ALPN is the negotiated ALPN protocol, if any.
+	ALPN string `json:"alpn"`
+
+	// Bytes is the number of bytes transferred.
+	Bytes int64 `json:"bytes"`
+
+	// CPU is the CPU time consumed by the process during the transfers,
+	// which we only measure for the whole measurement.
+	CPU *cpuusage.Usage `json:"cpu,omitempty"`
+
+	// Elapsed is the time elapsed since the beginning of the transfer.
+	Elapsed time.Duration `json:"elapsed_ns"`
+
+	// Err is the error that occurred, if any.
+	Err error `json:"-"`
+
+	// Flows contains the results of each connection, or of each stream,
+	// when running more than one, in which case this [*Result] aggregates
+	// them and does not contain samples.
+	Flows []*Result `json:"flows,omitempty"`
+
+	// LocalAddr is the local address of the connection used.
+	LocalAddr string `json:"local_addr"`
+
+	// Method is the HTTP method used for the transfer.
+	Method string `json:"method"`
+
+	// Probes contains the results of the responsiveness probes, if any.
+	Probes []*ProbeResult `json:"probes,omitempty"`
+
+	// Proto is the HTTP protocol version used by the response.
+	Proto string `json:"proto"`
+
+	// Server contains the measurements observed by the server, if available.
+	Server *ServerResult `json:"server"`
+
+	// Samples contains the per-interval progress samples, which are
+	// collected on the response body for GET and on the request body for PUT.
+	Samples []slogging.Sample `json:"samples"`
+
+	// Start is the time when the transfer started.
+	Start time.Time `json:"start"`
+
+	// TCPInfo contains the TCP_INFO samples of the measured connection.
+	TCPInfo []tcpinfo.Sample `json:"tcpinfo"`
+
+	// URL is the URL used for the transfer.
+	URL string `json:"url"`
+}
+
+// Log logs the result using the given event name.
+func (r *Result) Log(event string) {
+	slog.Info(event,
+		slog.String("bytes", humanize.IEC(float64(r.Bytes), "B")),
+		slog.Duration("elapsed", r.Elapsed),
+		slog.String("speed", humanize.SI(r.Speed(), "bit/s")),
+		slog.Any("err", r.Err),
+	)
+}
+
+// Speed returns the speed in bit/s or zero if no time has elapsed.
+func (r *Result) Speed() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Bytes) * 8 / r.Elapsed.Seconds()
+}
+
+// Run performs the HTTP transfers described by the given [*Config].
+func Run(ctx context.Context, config *Config) *Result {
+	transports := make([]http.RoundTripper, max(config.Connections, 1))
+	for idx := range transports {
+		transports[idx] = config.NewTransport()
+		defer closeIdleConnections(transports[idx])
+	}
+
+	meter := cpuusage.Start()
+	if config.ProbeInterval <= 0 {
+		result := runConns(ctx, config, transports)
+		result.CPU = meter.Stop()
+		result.CPU.Log("cpu", result.Bytes)
+		return result
+	}
+
+	probeCtx, cancel := context.WithCancel(ctx)
+	p := startProber(probeCtx, config, transports[0])
+	result := runConns(ctx, config, transports)
+	cancel()
+	result.Probes = p.wait()
+	result.CPU = meter.Stop()
+	result.CPU.Log("cpu", result.Bytes)
+	return result
+}
+
+// runConns performs the transfers using the given transports, each of which
+// creates a new connection, unless the transports share connections.
+func runConns(ctx context.Context, config *Config, transports []http.RoundTripper) *Result {
+	if len(transports) <= 1 {
+		result := runConn(ctx, config, transports[0])
+		if len(result.Flows) > 0 {
+			result.Log("aggregate")
+		}
+		return result
+	}
+
+	conns := make([]*Result, len(transports))
+	wg := &sync.WaitGroup{}
+	for idx, transport := range transports {
+		wg.Go(func() {
+			conns[idx] = runConn(ctx, config, transport)
+			if len(conns[idx].Flows) > 0 {
+				conns[idx].Log("connection")
+			}
+		})
+	}
+	wg.Wait()
+
+	result := aggregate(config, conns)
+	result.Log("aggregate")
+	return result
+}
+
+// runConn performs the transfers using the given transport.
+func runConn(ctx context.Context, config *Config, transport http.RoundTripper) *Result {
+	if config.Streams <= 1 {
+		return runFlow(ctx, config, transport)
+	}
+
+	// Establish the connection before starting the transfers, such that
+	// the HTTP/2 transport does not dial a connection per stream.
+	if err := prime(ctx, config, transport); err != nil {
+		return &Result{Err: err, Method: config.Method}
+	}
+
+	flows := make([]*Result, config.Streams)
+	wg := &sync.WaitGroup{}
+	for idx := range flows {
+		wg.Go(func() {
+			flows[idx] = runFlow(ctx, config, transport)
+		})
+	}
+	wg.Wait()
+	return aggregate(config, flows)
+}
+
+// closeIdleConnections closes the idle connections of the transport, if possible.
+func closeIdleConnections(transport http.RoundTripper) {
+	if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// prime performs a zero-length GET to establish the connection.
+func prime(ctx context.Context, config *Config, transport http.RoundTripper) error {
+	URL := &url.URL{Scheme: config.Scheme, Host: config.Host, Path: "/0"}
+	req, err := http.NewRequestWithContext(ctx, "GET", URL.String(), nil)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// aggregate merges the results of concurrent flows into a single [*Result].
+func aggregate(config *Config, flows []*Result) *Result {
+	result := &Result{Flows: flows, Method: config.Method}
+	var (
+		end  time.Time
+		errs []error
+	)
+	for idx, flow := range flows {
+		result.Bytes += flow.Bytes
+		if idx == 0 || flow.Start.Before(result.Start) {
+			result.Start = flow.Start
+		}
+		if flowEnd := flow.Start.Add(flow.Elapsed); flowEnd.After(end) {
+			end = flowEnd
+		}
+		errs = append(errs, flow.Err)
+	}
+	result.ALPN = flows[0].ALPN
+	result.Elapsed = end.Sub(result.Start)
+	result.Err = errors.Join(errs...)
+	result.Proto = flows[0].Proto
+	result.URL = flows[0].URL
+	result.LocalAddr = flows[0].LocalAddr
+	for _, flow := range flows {
+		if flow.LocalAddr != result.LocalAddr {
+			result.LocalAddr = "" // not a single connection
+			break
+		}
+	}
+	return result
+}
+
+// runFlow performs a single HTTP transfer.
+func runFlow(ctx context.Context, config *Config, transport http.RoundTripper) *Result {
+	result := &Result{Method: config.Method}
+	if config.Method != "GET" && config.Method != "PUT" {
+		result.Err = fmt.Errorf("bench: unsupported method: %s", config.Method)
+		return result
+	}
+	if config.Duration <= 0 && (config.Bytes < 0 || (config.Method == "PUT" && config.Bytes < 1)) {
+		result.Err = fmt.Errorf("bench: invalid number of bytes: %d", config.Bytes)
+		return result
+	}
+
+	interval := config.Interval
+	if interval <= 0 {
+		interval = slogging.DefaultInterval
+	}
+
+	URL := &url.URL{
+		Scheme: config.Scheme,
+		Host:   config.Host,
+		Path:   fmt.Sprintf("/%d", config.Bytes),
+	}
+	if config.Duration > 0 {
+		URL.Path = fmt.Sprintf("/time/%s", config.Duration)
+	}
+	result.URL = URL.String()
+	var (
+		body          io.Reader = http.NoBody
+		uploadWrapper *slogging.Reader
+	)
+	if config.Method == "PUT" {
+		body = io.LimitReader(infinite.Reader{}, config.Bytes)
+		if config.Duration > 0 {
+			body = newDeadlineReader(infinite.Reader{}, time.Now().Add(config.Duration))
+		}
+		// Instrument the request body to observe how fast the transport pulls bytes.
+		uploadWrapper = slogging.NewReader(body, interval)
+		body = uploadWrapper
+	}
+
+	// Sample TCP_INFO from the connection used by the request.
+	var sampler *tcpinfo.Sampler
+	defer func() {
+		if sampler != nil {
+			result.TCPInfo = sampler.Stop()
+		}
+	}()
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if sampler == nil {
+				sampler = tcpinfo.Start(info.Conn, interval)
+				result.LocalAddr = info.Conn.LocalAddr().String()
+			}
+		},
+	}
+	ctx = httptrace.WithClientTrace(ctx, trace)
+
+	req, err := http.NewRequestWithContext(ctx, config.Method, URL.String(), body)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	if config.Method == "PUT" && config.Duration <= 0 {
+		req.ContentLength = config.Bytes
+	}
+	if config.Method == "GET" && config.Trailers {
+		req.Header.Set("TE", "trailers")
+	}
+	slog.Info("request", slog.String("method", config.Method), slog.String("URL", URL.String()))
+
+	t0 := time.Now()
+	result.Start = t0
+	client := &http.Client{Transport: transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	bodyWrapper := slogging.NewReadCloser(resp.Body, interval)
+
+	result.Proto = resp.Proto
+	if resp.TLS != nil {
+		result.ALPN = resp.TLS.NegotiatedProtocol
+	}
+	slog.Info("response",
+		slog.Int("status", resp.StatusCode),
+		slog.String("proto", result.Proto),
+		slog.String("alpn", result.ALPN),
+	)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyWrapper.Close()
+		result.Err = fmt.Errorf("bench: unexpected status: %s", resp.Status)
+		return result
+	}
+
+	// For uploads, the response body contains the server measurements.
+	var sink io.Writer = io.Discard
+	respBody := &bytes.Buffer{}
+	if config.Method == "PUT" {
+		sink = respBody
+	}
+	buf := make([]byte, 1<<20) // 1 MiB
+	_, result.Err = io.CopyBuffer(sink, bodyWrapper, buf)
+	result.Elapsed = time.Since(t0)
+	bodyWrapper.Close()
+
+	// For uploads, the meaningful samples are the sender-side ones.
+	result.Bytes, result.Samples = bodyWrapper.Total(), bodyWrapper.Samples()
+	if uploadWrapper != nil {
+		result.Bytes, result.Samples = uploadWrapper.Total(), uploadWrapper.Samples()
+	}
+	result.Log("client")
+
+	if result.Err == nil {
+		server, err := parseServerResult(config.Method, resp, respBody.Bytes())
+		switch {
+		case err != nil:
+			slog.Info("server", slog.Any("err", err))
+		case server != nil:
+			result.Server = server
+			server.Log()
+		}
+	}
+	return result
+}
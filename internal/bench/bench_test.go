@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// benchChunk is the number of bytes transferred by each benchmark operation.
+const benchChunk = 1 << 20
+
+func TestMain(m *testing.M) {
+	// The transfers log their progress, which would drown the benchmark output.
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	os.Exit(m.Run())
+}
+
+// BenchmarkLoopback measures each stack on the loopback using the same
+// handlers and client code as the serve and measure commands, such that
+// we can compare the framing and TLS costs without any testbed:
+//
+//	go test -run '^$' -bench Loopback ./internal/bench
+//
+// Each operation transfers [benchChunk] bytes over a single transfer
+// lasting for the whole benchmark.
+func BenchmarkLoopback(b *testing.B) {
+	stacks := []struct {
+		name  string
+		start func(b *testing.B) *Config
+	}{
+		{"http1", benchStartHTTP1},
+		{"http1-tls", benchStartHTTP1TLS},
+		{"h2", benchStartH2},
+		{"h2c", benchStartH2C},
+	}
+	for _, stack := range stacks {
+		for _, method := range []string{"GET", "PUT"} {
+			b.Run(stack.name+"/"+method, func(b *testing.B) {
+				config := stack.start(b)
+				config.Method = method
+				benchRun(b, config)
+			})
+		}
+	}
+}
+
+// benchRun runs a single transfer of b.N operations using config.
+func benchRun(b *testing.B, config *Config) {
+	config.Bytes = int64(b.N) * benchChunk
+	b.SetBytes(benchChunk)
+	b.ReportAllocs()
+	b.ResetTimer()
+	result := Run(b.Context(), config)
+	b.StopTimer()
+	if result.Err != nil {
+		b.Fatal(result.Err)
+	}
+	if result.Bytes != config.Bytes {
+		b.Fatalf("transferred %d bytes instead of %d", result.Bytes, config.Bytes)
+	}
+}
+
+// benchStartHTTP1 is like the gohttp1 serve and measure commands.
+func benchStartHTTP1(b *testing.B) *Config {
+	srv := httptest.NewUnstartedServer(NewHandler())
+	srv.Config.ConnContext = ConnContext
+	srv.Start()
+	b.Cleanup(srv.Close)
+	return &Config{
+		Host: srv.Listener.Addr().String(),
+		NewTransport: func() http.RoundTripper {
+			return http.DefaultTransport.(*http.Transport).Clone()
+		},
+		Scheme: "http",
+	}
+}
+
+// benchStartHTTP1TLS is like the gohttp2 serve and measure commands without -2.
+func benchStartHTTP1TLS(b *testing.B) *Config {
+	srv := httptest.NewUnstartedServer(NewHandler())
+	srv.Config.ConnContext = ConnContext
+	srv.StartTLS()
+	b.Cleanup(srv.Close)
+	return &Config{
+		Host: srv.Listener.Addr().String(),
+		NewTransport: func() http.RoundTripper {
+			return srv.Client().Transport.(*http.Transport).Clone()
+		},
+		Scheme: "https",
+	}
+}
+
+// benchStartH2 is like the gohttp2 serve and measure commands with -2.
+func benchStartH2(b *testing.B) *Config {
+	h2config := DefaultClientH2Config()
+	srvConfig := DefaultServerH2Config()
+	srv := httptest.NewUnstartedServer(NewHandler())
+	srv.Config.ConnContext = srvConfig.ConnContext
+	if err := http2.ConfigureServer(srv.Config, srvConfig.NewServer()); err != nil {
+		b.Fatal(err)
+	}
+	srv.TLS = &tls.Config{NextProtos: []string{http2.NextProtoTLS}}
+	srv.StartTLS()
+	b.Cleanup(srv.Close)
+
+	host := srv.Listener.Addr().String()
+	tlsConfig := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	tlsConfig.NextProtos = []string{http2.NextProtoTLS}
+	return &Config{
+		Host: host,
+		NewTransport: func() http.RoundTripper {
+			h2transport := h2config.NewTransport()
+			h2transport.TLSClientConfig = tlsConfig
+			return NewH2Transport(h2transport, func(ctx context.Context) (net.Conn, error) {
+				return (&tls.Dialer{Config: tlsConfig}).DialContext(ctx, "tcp", host)
+			})
+		},
+		Scheme: "https",
+	}
+}
+
+// benchStartH2C is like the gohttp2c serve and measure commands.
+func benchStartH2C(b *testing.B) *Config {
+	h2config := DefaultClientH2Config()
+	srvConfig := DefaultServerH2Config()
+	srv := httptest.NewUnstartedServer(h2c.NewHandler(NewHandler(), srvConfig.NewServer()))
+	srv.Config.ConnContext = srvConfig.ConnContext
+	srv.Start()
+	b.Cleanup(srv.Close)
+
+	host := srv.Listener.Addr().String()
+	return &Config{
+		Host: host,
+		NewTransport: func() http.RoundTripper {
+			h2transport := h2config.NewTransport()
+			h2transport.AllowHTTP = true
+			return NewH2Transport(h2transport, func(ctx context.Context) (net.Conn, error) {
+				return h2config.DialContext(ctx, host)
+			})
+		},
+		Scheme: "http",
+	}
+}
@@ -0,0 +1,29 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"io"
+	"time"
+)
+
+// deadlineReader is an [io.Reader] returning [io.EOF] after a deadline.
+type deadlineReader struct {
+	deadline time.Time
+	r        io.Reader
+}
+
+// newDeadlineReader constructs a new [*deadlineReader].
+func newDeadlineReader(r io.Reader, deadline time.Time) *deadlineReader {
+	return &deadlineReader{deadline: deadline, r: r}
+}
+
+var _ io.Reader = &deadlineReader{}
+
+// Read implements [io.Reader].
+func (r *deadlineReader) Read(data []byte) (int, error) {
+	if !time.Now().Before(r.deadline) {
+		return 0, io.EOF
+	}
+	return r.r.Read(data)
+}
@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/bassosimone/runtimex"
+	"golang.org/x/net/http2"
+)
+
+// H2Config contains the HTTP/2 flow control and frame size settings, as
+// well as the socket buffer sizes, used by the serve and measure commands.
+//
+// A zero value means using the library or the kernel default.
+type H2Config struct {
+	// ConnWindow is the connection-level receive window.
+	ConnWindow int32
+
+	// MaxConcurrentStreams is the SETTINGS_MAX_CONCURRENT_STREAMS sent by servers.
+	MaxConcurrentStreams uint32
+
+	// MaxFrameSize is the SETTINGS_MAX_FRAME_SIZE, i.e., the largest frame we read.
+	MaxFrameSize uint32
+
+	// ReadBuffer is the socket receive buffer size (SO_RCVBUF).
+	ReadBuffer int
+
+	// StreamWindow is the stream-level receive window.
+	StreamWindow int32
+
+	// WriteBuffer is the socket send buffer size (SO_SNDBUF).
+	WriteBuffer int
+}
+
+// DefaultClientH2Config returns the [*H2Config] used by default by the
+// measure commands, with 1 MiB frames and windows large enough that flow
+// control does not limit the transfer.
+func DefaultClientH2Config() *H2Config {
+	return &H2Config{
+		ConnWindow:   1 << 30,
+		MaxFrameSize: 1 << 20,
+		StreamWindow: 4 << 20,
+	}
+}
+
+// DefaultServerH2Config returns the [*H2Config] used by default by the
+// serve commands, with the largest frames and 1 GiB windows.
+func DefaultServerH2Config() *H2Config {
+	return &H2Config{
+		ConnWindow:   1 << 30,
+		MaxFrameSize: 1<<24 - 1,
+		StreamWindow: 1 << 30,
+	}
+}
+
+// Log logs the settings, which the commands do at startup.
+func (c *H2Config) Log() {
+	slog.Info("h2config",
+		slog.Int64("connWindow", int64(c.ConnWindow)),
+		slog.Uint64("maxConcurrentStreams", uint64(c.MaxConcurrentStreams)),
+		slog.Uint64("maxFrameSize", uint64(c.MaxFrameSize)),
+		slog.Int("readBuffer", c.ReadBuffer),
+		slog.Int64("streamWindow", int64(c.StreamWindow)),
+		slog.Int("writeBuffer", c.WriteBuffer),
+	)
+}
+
+// NewServer returns a new [*http2.Server] using the settings.
+func (c *H2Config) NewServer() *http2.Server {
+	return &http2.Server{
+		MaxConcurrentStreams:         c.MaxConcurrentStreams,
+		MaxReadFrameSize:             c.MaxFrameSize,
+		MaxUploadBufferPerConnection: c.ConnWindow,
+		MaxUploadBufferPerStream:     c.StreamWindow,
+	}
+}
+
+// NewTransport returns a new [*http2.Transport] using the settings.
+//
+// The [*http2.Transport] only reads the receive windows from the
+// [*http.Transport] it is configured for, so we configure one.
+func (c *H2Config) NewTransport() *http2.Transport {
+	t1 := &http.Transport{
+		HTTP2: &http.HTTP2Config{
+			MaxReadFrameSize:              int(c.MaxFrameSize),
+			MaxReceiveBufferPerConnection: int(c.ConnWindow),
+			MaxReceiveBufferPerStream:     int(c.StreamWindow),
+		},
+	}
+	t2 := runtimex.PanicOnError1(http2.ConfigureTransports(t1))
+	t2.MaxReadFrameSize = c.MaxFrameSize
+	return t2
+}
+
+// ConnContext is like [ConnContext] but also sets the socket buffer sizes.
+func (c *H2Config) ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	if err := c.setBuffers(conn); err != nil {
+		slog.Info("cannot set socket buffers", slog.Any("err", err))
+	}
+	return ConnContext(ctx, conn)
+}
+
+// DialContext dials a TCP connection and sets the socket buffer sizes.
+func (c *H2Config) DialContext(ctx context.Context, address string) (net.Conn, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.setBuffers(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// setBuffers sets the socket buffer sizes, if configured.
+func (c *H2Config) setBuffers(conn net.Conn) error {
+	// Servers may see a wrapped connection, e.g., when emulating a link.
+	for {
+		wrapper, ok := conn.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		conn = wrapper.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if c.ReadBuffer > 0 {
+		if err := tcpConn.SetReadBuffer(c.ReadBuffer); err != nil {
+			return err
+		}
+	}
+	if c.WriteBuffer > 0 {
+		if err := tcpConn.SetWriteBuffer(c.WriteBuffer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+
+	"golang.org/x/net/http2"
+)
+
+// H2Transport is an [http.RoundTripper] sending all the requests over
+// a single HTTP/2 connection, which it dials on first use.
+//
+// Unlike [*http2.Transport], it guarantees that concurrent requests
+// share the same connection and it allows sending PING frames on
+// such a connection, which we need to measure responsiveness.
+//
+// Construct using [NewH2Transport].
+type H2Transport struct {
+	cc   *http2.ClientConn
+	conn net.Conn
+	dial func(ctx context.Context) (net.Conn, error)
+	mu   sync.Mutex
+	t    *http2.Transport
+}
+
+// NewH2Transport constructs a new [*H2Transport] using the given
+// [*http2.Transport] settings and dial function. When using TLS, the
+// dial function must return a [*tls.Conn] that negotiated "h2".
+func NewH2Transport(t *http2.Transport, dial func(ctx context.Context) (net.Conn, error)) *H2Transport {
+	return &H2Transport{dial: dial, t: t}
+}
+
+var _ http.RoundTripper = &H2Transport{}
+
+// RoundTrip implements [http.RoundTripper].
+func (t *H2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cc, conn, reused, err := t.clientConn(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	// The [*http2.ClientConn] does not invoke GotConn, so we do it.
+	if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{Conn: conn, Reused: reused})
+	}
+	return cc.RoundTrip(req)
+}
+
+// Ping sends a PING frame and waits for the corresponding ACK.
+func (t *H2Transport) Ping(ctx context.Context) error {
+	cc, _, _, err := t.clientConn(ctx)
+	if err != nil {
+		return err
+	}
+	return cc.Ping(ctx)
+}
+
+// CloseIdleConnections closes the connection, if any.
+func (t *H2Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cc != nil {
+		t.cc.Close()
+		t.cc, t.conn = nil, nil
+	}
+}
+
+func (t *H2Transport) clientConn(ctx context.Context) (*http2.ClientConn, net.Conn, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cc != nil {
+		return t.cc, t.conn, true, nil
+	}
+	conn, err := t.dial(ctx)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	cc, err := t.t.NewClientConn(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, false, err
+	}
+	t.cc, t.conn = cc, conn
+	return cc, conn, false, nil
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"maps"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Pinger is implemented by transports that can send HTTP/2 PING frames.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// ProbeResult contains the results of a kind of responsiveness probe.
+type ProbeResult struct {
+	// Failures is the number of failed probes.
+	Failures int `json:"failures"`
+
+	// Kind is the kind of probe (e.g., "http-same-conn").
+	Kind string `json:"kind"`
+
+	// P50 is the median RTT.
+	P50 time.Duration `json:"p50_ns"`
+
+	// P90 is the 90th percentile RTT.
+	P90 time.Duration `json:"p90_ns"`
+
+	// P99 is the 99th percentile RTT.
+	P99 time.Duration `json:"p99_ns"`
+
+	// RTTs contains the RTT of each successful probe.
+	RTTs []time.Duration `json:"rtts_ns"`
+}
+
+// prober periodically runs responsiveness probes.
+type prober struct {
+	config  *Config
+	mu      sync.Mutex
+	results map[string]*ProbeResult
+	wg      sync.WaitGroup
+}
+
+// startProber starts running probes every interval using the same transport
+// used for the bulk transfer and a separate transport, until ctx is done.
+//
+// We only probe over the same connection when the transport implements
+// [Pinger], i.e., with HTTP/2, since an HTTP/1.1 transport cannot multiplex
+// and would dial another connection for each probe.
+func startProber(ctx context.Context, config *Config, same http.RoundTripper) *prober {
+	p := &prober{config: config, results: map[string]*ProbeResult{}}
+	separate := config.NewTransport()
+	p.wg.Go(func() {
+		defer closeIdleConnections(separate)
+		ticker := time.NewTicker(config.ProbeInterval)
+		defer ticker.Stop()
+		inflight := &sync.WaitGroup{}
+		defer inflight.Wait()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			inflight.Go(func() { p.probeHTTP(ctx, "http-separate-conn", separate) })
+			if pinger, ok := same.(Pinger); ok {
+				inflight.Go(func() { p.probeHTTP(ctx, "http-same-conn", same) })
+				inflight.Go(func() { p.probePing(ctx, "ping-same-conn", pinger) })
+			}
+			if pinger, ok := separate.(Pinger); ok {
+				inflight.Go(func() { p.probePing(ctx, "ping-separate-conn", pinger) })
+			}
+		}
+	})
+	return p
+}
+
+// probeHTTP measures the time to fetch a zero-length body.
+func (p *prober) probeHTTP(ctx context.Context, kind string, transport http.RoundTripper) {
+	URL := &url.URL{Scheme: p.config.Scheme, Host: p.config.Host, Path: "/0"}
+	t0 := time.Now()
+	err := func() error {
+		req, err := http.NewRequestWithContext(ctx, "GET", URL.String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}()
+	p.record(ctx, kind, time.Since(t0), err)
+}
+
+// probePing measures the time to receive the ACK of a PING frame.
+func (p *prober) probePing(ctx context.Context, kind string, pinger Pinger) {
+	t0 := time.Now()
+	err := pinger.Ping(ctx)
+	p.record(ctx, kind, time.Since(t0), err)
+}
+
+// record records the outcome of a probe of the given kind. Probes
+// interrupted because the transfers are over are not failures.
+func (p *prober) record(ctx context.Context, kind string, rtt time.Duration, err error) {
+	if err != nil && ctx.Err() != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := p.results[kind]
+	if result == nil {
+		result = &ProbeResult{Kind: kind, RTTs: []time.Duration{}}
+		p.results[kind] = result
+	}
+	if err != nil {
+		result.Failures++
+		return
+	}
+	result.RTTs = append(result.RTTs, rtt)
+}
+
+// wait waits for the probes to terminate and returns the results.
+func (p *prober) wait() []*ProbeResult {
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var results []*ProbeResult
+	for _, kind := range slices.Sorted(maps.Keys(p.results)) {
+		result := p.results[kind]
+		sorted := slices.Sorted(slices.Values(result.RTTs))
+		result.P50 = percentile(sorted, 0.50)
+		result.P90 = percentile(sorted, 0.90)
+		result.P99 = percentile(sorted, 0.99)
+		slog.Info("probe",
+			slog.String("kind", kind),
+			slog.Int("count", len(sorted)),
+			slog.Int("failures", result.Failures),
+			slog.Duration("p50", result.P50),
+			slog.Duration("p90", result.P90),
+			slog.Duration("p99", result.P99),
+		)
+		results = append(results, result)
+	}
+	return results
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []time.Duration, fraction float64) time.Duration {
+	if len(sorted) <= 0 {
+		return 0
+	}
+	idx := int(math.Ceil(fraction*float64(len(sorted)))) - 1
+	return sorted[max(idx, 0)]
+}
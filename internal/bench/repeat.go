@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"log/slog"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+	"github.com/bassosimone/2026-02-http2-perf/internal/stats"
+)
+
+// Repeat calls run warmup+count times and returns the results of the
+// last count calls, discarding the warm-up ones. We stop at the first
+// failure, in which case the failed result is the last one returned.
+//
+// When returning more than one result, we also log their summary.
+func Repeat(warmup, count int, run func() *Result) []*Result {
+	var results []*Result
+	for idx := range warmup + count {
+		result := run()
+		if result.Err != nil {
+			return append(results, result)
+		}
+		if idx < warmup {
+			slog.Info("discarding warm-up run", slog.Int("run", idx))
+			continue
+		}
+		results = append(results, result)
+	}
+	if len(results) > 1 {
+		LogSummary(stats.Summarize(Speeds(results)))
+	}
+	return results
+}
+
+// Speeds returns the speeds of the results in bit/s.
+func Speeds(results []*Result) []float64 {
+	speeds := make([]float64, 0, len(results))
+	for _, result := range results {
+		speeds = append(speeds, result.Speed())
+	}
+	return speeds
+}
+
+// LogSummary logs the summary of the speeds returned by [Speeds].
+func LogSummary(summary *stats.Summary) {
+	slog.Info("summary",
+		slog.Int("count", summary.Count),
+		slog.String("median", humanize.SI(summary.Median, "bit/s")),
+		slog.String("ciLow", humanize.SI(summary.CILow, "bit/s")),
+		slog.String("ciHigh", humanize.SI(summary.CIHigh, "bit/s")),
+		slog.String("mean", humanize.SI(summary.Mean, "bit/s")),
+		slog.String("stddev", humanize.SI(summary.Stddev, "bit/s")),
+		slog.String("min", humanize.SI(summary.Min, "bit/s")),
+		slog.String("max", humanize.SI(summary.Max, "bit/s")),
+	)
+}
@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/stats"
+)
+
+// Report is the machine-readable document written by the measure commands.
+type Report struct {
+	// Args contains the command line arguments used for the measurement.
+	Args []string `json:"args"`
+
+	// Repetitions contains the results of the successful repetitions,
+	// excluding the warm-up ones, when running more than one.
+	Repetitions []*Result `json:"repetitions,omitempty"`
+
+	// Result contains the measurement result, which is the result
+	// of the last repetition when running more than one.
+	Result *Result `json:"result"`
+
+	// Stack is the name of the measured stack (e.g., gohttp2).
+	Stack string `json:"stack"`
+
+	// Summary summarizes the speed of the successful repetitions in bit/s,
+	// when running more than one.
+	Summary *stats.Summary `json:"summary,omitempty"`
+
+	// Time is the time when the report was generated.
+	Time time.Time `json:"time"`
+}
+
+// NewReport constructs a new [*Report] from the results returned by [Repeat].
+//
+// We exclude the failed result, if any, from the repetitions and the summary,
+// since its speed only reflects the bytes transferred before failing.
+func NewReport(stack string, args []string, results ...*Result) *Report {
+	report := &Report{
+		Args:   args,
+		Result: results[len(results)-1],
+		Stack:  stack,
+		Time:   time.Now(),
+	}
+	var succeeded []*Result
+	for _, result := range results {
+		if result.Err == nil {
+			succeeded = append(succeeded, result)
+		}
+	}
+	if len(succeeded) > 1 {
+		report.Repetitions = succeeded
+		report.Summary = stats.Summarize(Speeds(succeeded))
+	}
+	return report
+}
+
+// WriteFile writes the [*Report] as JSON to the given file.
+func (r *Report) WriteFile(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// MarshalJSON implements [json.Marshaler].
+//
+// We need a custom marshaler because [error] does not serialize to JSON.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	type alias Result
+	var failure string
+	if r.Err != nil {
+		failure = r.Err.Error()
+	}
+	return json.Marshal(struct {
+		*alias
+		Failure string `json:"failure"`
+	}{(*alias)(r), failure})
+}
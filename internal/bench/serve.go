@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/cpuusage"
+	"github.com/bassosimone/2026-02-http2-perf/internal/infinite"
+	"github.com/bassosimone/2026-02-http2-perf/internal/slogging"
+	"github.com/bassosimone/2026-02-http2-perf/internal/tcpinfo"
+)
+
+// MaxDuration is the maximum duration accepted by the time-bounded handlers.
+//
+// A time-bounded GET sends as fast as it can until the deadline, so we bound
+// it to prevent a mistyped duration (e.g., 10m instead of 10s) from keeping the
+// link and the server busy for long. A minute is still much longer than the
+// few seconds TCP needs to reach steady state, even with a large BDP.
+const MaxDuration = time.Minute
+
+// NewHandler returns the [http.Handler] used by the serve commands.
+//
+// The handler serves these routes:
+//
+//   - GET /{size} sends size bytes to the client;
+//
+//   - PUT /{size} reads size bytes from the client;
+//
+//   - GET /time/{duration} sends bytes to the client for duration;
+//
+//   - PUT /time/{duration} reads bytes from the client until EOF.
+func NewHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /{size}", http.HandlerFunc(serveHandleGet))
+	mux.Handle("PUT /{size}", http.HandlerFunc(serveHandlePut))
+	mux.Handle("GET /time/{duration}", http.HandlerFunc(serveHandleGetTime))
+	mux.Handle("PUT /time/{duration}", http.HandlerFunc(serveHandlePutTime))
+	return mux
+}
+
+// connContextKey is the context key for the [net.Conn].
+type connContextKey struct{}
+
+// ConnContext is a hook for [http.Server] ConnContext that saves the
+// [net.Conn] into the context, so the handlers can sample TCP_INFO.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// sampleTCPInfo starts sampling TCP_INFO for the connection serving
+// the given request and returns a function to stop sampling.
+func sampleTCPInfo(req *http.Request) func() {
+	conn, _ := req.Context().Value(connContextKey{}).(net.Conn)
+	if conn == nil {
+		return func() {}
+	}
+	sampler := tcpinfo.Start(conn, slogging.DefaultInterval)
+	return func() { sampler.Stop() }
+}
+
+// logRequest logs the request using the given event name.
+func logRequest(event string, req *http.Request, attrs ...slog.Attr) {
+	attrs = append(attrs, slog.String("proto", req.Proto))
+	if req.TLS != nil {
+		attrs = append(attrs, slog.String("alpn", req.TLS.NegotiatedProtocol))
+	}
+	slog.LogAttrs(req.Context(), slog.LevelInfo, event, attrs...)
+}
+
+// parseDuration parses the duration path value.
+func parseDuration(req *http.Request) (time.Duration, error) {
+	duration, err := time.ParseDuration(req.PathValue("duration"))
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 || duration > MaxDuration {
+		return 0, errors.New("bench: duration out of range")
+	}
+	return duration, nil
+}
+
+func serveHandleGet(rw http.ResponseWriter, req *http.Request) {
+	count, err := strconv.ParseInt(req.PathValue("size"), 10, 64)
+	if err != nil || count < 0 {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logRequest("GET", req, slog.Int64("count", count))
+	defer sampleTCPInfo(req)()
+	// HTTP/1.1 can only send trailers using chunked encoding, so, to avoid
+	// changing the HTTP/1.1 baseline wire format, we only send them when the
+	// client asks for them using `TE: trailers`.
+	chunked := req.ProtoMajor < 2 && acceptsTrailers(req)
+	if !chunked {
+		rw.Header().Set("Content-Length", strconv.FormatInt(count, 10))
+	}
+	serveSend(rw, io.LimitReader(infinite.Reader{}, count), req.ProtoMajor >= 2 || chunked)
+}
+
+// acceptsTrailers returns whether the request TE header contains trailers.
+func acceptsTrailers(req *http.Request) bool {
+	for _, value := range req.Header.Values("TE") {
+		for token := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func serveHandlePut(rw http.ResponseWriter, req *http.Request) {
+	expectCount, err := strconv.ParseInt(req.PathValue("size"), 10, 64)
+	if err != nil || expectCount < 0 {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logRequest("PUT", req, slog.Int64("expectCount", expectCount))
+	defer sampleTCPInfo(req)()
+	serveReceive(rw, req, expectCount)
+}
+
+func serveHandleGetTime(rw http.ResponseWriter, req *http.Request) {
+	duration, err := parseDuration(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logRequest("GET", req, slog.Duration("duration", duration))
+	defer sampleTCPInfo(req)()
+	serveSend(rw, newDeadlineReader(infinite.Reader{}, time.Now().Add(duration)), true)
+}
+
+func serveHandlePutTime(rw http.ResponseWriter, req *http.Request) {
+	duration, err := parseDuration(req)
+	if err != nil {
+		rw.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	logRequest("PUT", req, slog.Duration("duration", duration))
+	defer sampleTCPInfo(req)()
+	serveReceive(rw, req, math.MaxInt64)
+}
+
+// serveSend sends the body and then, if trailers is true, the [ServerResult]
+// as trailers.
+func serveSend(rw http.ResponseWriter, body io.Reader, trailers bool) {
+	if trailers {
+		rw.Header().Set("Trailer", strings.Join([]string{
+			TrailerBytes, TrailerCPUClock, TrailerCPUSystem, TrailerCPUUser, TrailerElapsed, TrailerWriteTime,
+		}, ", "))
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	meter := cpuusage.Start()
+	t0 := time.Now()
+	writer := &timingWriter{w: rw}
+	var count int64
+	if rf, ok := rw.(io.ReaderFrom); ok {
+		// Preserve the HTTP/1.1 [io.ReaderFrom] fast path.
+		count, _ = writer.readFrom(rf, body)
+	} else {
+		buf := make([]byte, 1<<20) // 1 MiB
+		count, _ = io.CopyBuffer(writer, body, buf)
+	}
+
+	result := NewServerResult(count, time.Since(t0))
+	result.CPU = meter.Stop()
+	result.WriteTime = writer.elapsed
+	result.Log()
+	if !trailers {
+		return
+	}
+	for key, value := range CPUTrailers(result.CPU) {
+		rw.Header().Set(key, value)
+	}
+	rw.Header().Set(TrailerBytes, strconv.FormatInt(result.Bytes, 10))
+	rw.Header().Set(TrailerElapsed, strconv.FormatInt(int64(result.Elapsed), 10))
+	rw.Header().Set(TrailerWriteTime, strconv.FormatInt(int64(result.WriteTime), 10))
+}
+
+// serveReceive reads up to count bytes from the body and then
+// sends the [ServerResult] as the JSON response body.
+func serveReceive(rw http.ResponseWriter, req *http.Request, count int64) {
+	meter := cpuusage.Start()
+	t0 := time.Now()
+	bodyWrapper := slogging.NewReadCloser(req.Body, slogging.DefaultInterval)
+	defer bodyWrapper.Close()
+	buf := make([]byte, 1<<20) // 1 MiB
+	io.CopyBuffer(io.Discard, io.LimitReader(bodyWrapper, count), buf)
+
+	result := NewServerResult(bodyWrapper.Total(), time.Since(t0))
+	result.CPU = meter.Stop()
+	result.Log()
+	data, err := json.Marshal(result)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(data)
+}
+
+// timingWriter is an [io.Writer] measuring the time spent writing.
+type timingWriter struct {
+	elapsed time.Duration
+	w       io.Writer
+}
+
+// Write implements [io.Writer].
+func (w *timingWriter) Write(data []byte) (int, error) {
+	t0 := time.Now()
+	count, err := w.w.Write(data)
+	w.elapsed += time.Since(t0)
+	return count, err
+}
+
+func (w *timingWriter) readFrom(rf io.ReaderFrom, r io.Reader) (int64, error) {
+	t0 := time.Now()
+	count, err := rf.ReadFrom(r)
+	w.elapsed += time.Since(t0)
+	return count, err
+}
@@ -0,0 +1,140 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package bench
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/cpuusage"
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+)
+
+const (
+	// TrailerBytes is the trailer containing the number of bytes written by the server.
+	TrailerBytes = "Bench-Bytes"
+
+	// TrailerCPUClock is the optional trailer containing the server CPU clock in Hz.
+	TrailerCPUClock = "Bench-CPU-Clock"
+
+	// TrailerCPUSystem is the optional trailer containing the server system CPU time in nanoseconds.
+	TrailerCPUSystem = "Bench-CPU-System"
+
+	// TrailerCPUUser is the optional trailer containing the server user CPU time in nanoseconds.
+	TrailerCPUUser = "Bench-CPU-User"
+
+	// TrailerElapsed is the trailer containing the server-side elapsed time in nanoseconds.
+	TrailerElapsed = "Bench-Elapsed"
+
+	// TrailerWriteTime is the trailer containing the nanoseconds spent writing the body.
+	TrailerWriteTime = "Bench-Write-Time"
+)
+
+// ServerResult contains the measurements observed by the server.
+//
+// The server sends it as a JSON body in response to PUT and as
+// trailers (see [TrailerBytes]) in response to GET, except for HTTP/1.1
+// responses with a Content-Length, which cannot carry trailers.
+type ServerResult struct {
+	// Bytes is the number of bytes transferred.
+	Bytes int64 `json:"bytes"`
+
+	// CPU is the CPU time consumed by the server process, if available.
+	CPU *cpuusage.Usage `json:"cpu,omitempty"`
+
+	// Elapsed is the time spent transferring the body.
+	Elapsed time.Duration `json:"elapsed_ns"`
+
+	// Speed is the server-side speed in bit/s.
+	Speed float64 `json:"speed"`
+
+	// WriteTime is the time spent writing the body, set only for GET.
+	WriteTime time.Duration `json:"write_time_ns,omitempty"`
+}
+
+// NewServerResult returns the [*ServerResult] of transferring count bytes
+// in the given elapsed time.
+func NewServerResult(count int64, elapsed time.Duration) *ServerResult {
+	result := &ServerResult{Bytes: count, Elapsed: elapsed}
+	if elapsed > 0 {
+		result.Speed = float64(count) * 8 / elapsed.Seconds()
+	}
+	return result
+}
+
+// parseServerResult parses the [*ServerResult] from the response.
+//
+// We must call this function after reading the body until EOF, since
+// this is when trailers become available. It returns nil and no error
+// when the response cannot carry trailers.
+func parseServerResult(method string, resp *http.Response, body []byte) (*ServerResult, error) {
+	if method == "PUT" {
+		result := &ServerResult{}
+		if err := json.Unmarshal(body, result); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+	if resp.ProtoMajor < 2 && resp.ContentLength >= 0 {
+		return nil, nil
+	}
+	return ParseTrailer(resp.Trailer)
+}
+
+// ParseTrailer parses the [*ServerResult] from the trailers of a GET response.
+func ParseTrailer(trailer http.Header) (*ServerResult, error) {
+	count, err := strconv.ParseInt(trailer.Get(TrailerBytes), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	elapsed, err := strconv.ParseInt(trailer.Get(TrailerElapsed), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	writeTime, err := strconv.ParseInt(trailer.Get(TrailerWriteTime), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	result := NewServerResult(count, time.Duration(elapsed))
+	result.WriteTime = time.Duration(writeTime)
+
+	// The CPU trailers are optional because not all servers send them.
+	if user, err := strconv.ParseInt(trailer.Get(TrailerCPUUser), 10, 64); err == nil {
+		system, _ := strconv.ParseInt(trailer.Get(TrailerCPUSystem), 10, 64)
+		clock, _ := strconv.ParseFloat(trailer.Get(TrailerCPUClock), 64)
+		result.CPU = &cpuusage.Usage{
+			ClockHz: clock,
+			System:  time.Duration(system),
+			User:    time.Duration(user),
+			Wall:    result.Elapsed,
+		}
+	}
+	return result, nil
+}
+
+// CPUTrailers returns the CPU trailers (see [TrailerCPUUser]) for the
+// given usage or nil if the usage is nil.
+func CPUTrailers(usage *cpuusage.Usage) map[string]string {
+	if usage == nil {
+		return nil
+	}
+	return map[string]string{
+		TrailerCPUClock:  strconv.FormatFloat(usage.ClockHz, 'f', -1, 64),
+		TrailerCPUSystem: strconv.FormatInt(int64(usage.System), 10),
+		TrailerCPUUser:   strconv.FormatInt(int64(usage.User), 10),
+	}
+}
+
+// Log logs the result using the "server" event name.
+func (r *ServerResult) Log() {
+	slog.Info("server",
+		slog.String("bytes", humanize.IEC(float64(r.Bytes), "B")),
+		slog.Duration("elapsed", r.Elapsed),
+		slog.String("speed", humanize.SI(r.Speed, "bit/s")),
+		slog.Duration("writeTime", r.WriteTime),
+	)
+	r.CPU.Log("serverCPU", r.Bytes)
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package cpuusage measures the CPU time consumed by the process
+// to compute the CPU cost of transferring bytes.
+package cpuusage
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Usage is the CPU time consumed by the whole process during an interval.
+//
+// Because we measure the whole process, with concurrent transfers the
+// usage of each transfer includes the CPU consumed by the others.
+type Usage struct {
+	// ClockHz is the nominal CPU clock frequency or zero if unknown.
+	ClockHz float64 `json:"clock_hz"`
+
+	// System is the CPU time spent in the kernel.
+	System time.Duration `json:"system_ns"`
+
+	// User is the CPU time spent in user space.
+	User time.Duration `json:"user_ns"`
+
+	// Wall is the wall-clock duration of the interval.
+	Wall time.Duration `json:"wall_ns"`
+}
+
+// Meter measures the [*Usage] since [Start].
+type Meter struct {
+	start *Usage
+	t0    time.Time
+}
+
+// Start starts measuring the CPU usage.
+func Start() *Meter {
+	start, err := getrusage()
+	if err != nil {
+		slog.Info("cannot measure CPU usage", slog.Any("err", err))
+	}
+	return &Meter{start: start, t0: time.Now()}
+}
+
+// Stop returns the [*Usage] since [Start] or nil if we cannot measure it.
+func (m *Meter) Stop() *Usage {
+	wall := time.Since(m.t0)
+	end, err := getrusage()
+	if err != nil || m.start == nil {
+		return nil
+	}
+	return &Usage{
+		ClockHz: clockHz(),
+		System:  end.System - m.start.System,
+		User:    end.User - m.start.User,
+		Wall:    wall,
+	}
+}
+
+// CPU returns the total CPU time.
+func (u *Usage) CPU() time.Duration {
+	return u.User + u.System
+}
+
+// Utilization returns the CPU time divided by the wall time, i.e., the
+// average number of busy cores, which is low when we wait for the peer.
+func (u *Usage) Utilization() float64 {
+	if u.Wall <= 0 {
+		return 0
+	}
+	return u.CPU().Seconds() / u.Wall.Seconds()
+}
+
+// SecondsPerGiB returns the CPU seconds spent per GiB transferred.
+func (u *Usage) SecondsPerGiB(count int64) float64 {
+	if count <= 0 {
+		return 0
+	}
+	return u.CPU().Seconds() / (float64(count) / (1 << 30))
+}
+
+// BitsPerCycle returns the bits transferred per CPU cycle or zero
+// if the clock frequency is unknown.
+func (u *Usage) BitsPerCycle(count int64) float64 {
+	cycles := u.CPU().Seconds() * u.ClockHz
+	if cycles <= 0 {
+		return 0
+	}
+	return float64(count) * 8 / cycles
+}
+
+// Log logs the usage and the CPU cost of transferring count bytes
+// using the given event name. It does nothing if u is nil.
+func (u *Usage) Log(event string, count int64) {
+	if u == nil {
+		return
+	}
+	slog.Info(event,
+		slog.Duration("user", u.User),
+		slog.Duration("system", u.System),
+		slog.Duration("wall", u.Wall),
+		slog.Float64("utilization", u.Utilization()),
+		slog.Float64("cpuSecondsPerGiB", u.SecondsPerGiB(count)),
+		slog.Float64("bitsPerCycle", u.BitsPerCycle(count)),
+	)
+}
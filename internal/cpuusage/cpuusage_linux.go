@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build linux
+
+package cpuusage
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func getrusage() (*Usage, error) {
+	var rusage unix.Rusage
+	if err := unix.Getrusage(unix.RUSAGE_SELF, &rusage); err != nil {
+		return nil, err
+	}
+	return &Usage{
+		System: time.Duration(rusage.Stime.Nano()),
+		User:   time.Duration(rusage.Utime.Nano()),
+	}, nil
+}
+
+// clockHz returns the nominal clock frequency, preferring the base
+// frequency exported by cpufreq over the current one in /proc/cpuinfo,
+// which varies with frequency scaling.
+func clockHz() float64 {
+	for _, name := range []string{
+		"/sys/devices/system/cpu/cpu0/cpufreq/base_frequency",
+		"/sys/devices/system/cpu/cpu0/cpufreq/cpuinfo_max_freq",
+	} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		if khz, err := strconv.ParseFloat(string(bytes.TrimSpace(data)), 64); err == nil && khz > 0 {
+			return khz * 1e3
+		}
+	}
+
+	data, err := os.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(key) != "cpu MHz" {
+			continue
+		}
+		if mhz, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && mhz > 0 {
+			return mhz * 1e6
+		}
+	}
+	return 0
+}
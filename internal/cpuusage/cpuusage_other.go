@@ -0,0 +1,15 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build !linux
+
+package cpuusage
+
+import "errors"
+
+func getrusage() (*Usage, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func clockHz() float64 {
+	return 0
+}
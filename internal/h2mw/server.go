@@ -0,0 +1,456 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package h2mw implements an experimental cleartext HTTP/2 server where
+// handler goroutines write DATA frames directly to the connection.
+//
+// The [golang.org/x/net/http2] server funnels all frame writes through
+// a single serve goroutine. Here, instead, each handler goroutine holds a
+// write lock while it writes as many DATA frames as the flow control
+// windows permit into a large buffer, which it then flushes with a single
+// write syscall. This allows us to measure the upper bound that a
+// redesigned Go HTTP/2 server could reach.
+//
+// The server only supports prior knowledge HTTP/2 (i.e., no upgrade from
+// HTTP/1.1) and it does not implement priorities, server push, or limits
+// on the number of concurrent streams.
+package h2mw
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// Protocol defaults from RFC 9113.
+const (
+	initialMaxFrameSize = 1 << 14
+	initialWindowSize   = 65535
+	maxFrameSize        = 1<<24 - 1
+	maxWindowSize       = 1<<31 - 1
+)
+
+// Server is the experimental multi-writer HTTP/2 server.
+type Server struct {
+	// ConnContext optionally modifies the context used for a new connection.
+	ConnContext func(ctx context.Context, conn net.Conn) context.Context
+
+	// ConnWindow is the connection-level receive window. If zero, we use
+	// the maximum window allowed by the protocol.
+	ConnWindow uint32
+
+	// Handler is the [http.Handler] serving requests.
+	Handler http.Handler
+
+	// MaxReadFrameSize is the largest frame we are willing to read. If
+	// zero, we use the maximum frame size allowed by the protocol.
+	MaxReadFrameSize uint32
+
+	// StreamWindow is the stream-level receive window. If zero, we use
+	// the maximum window allowed by the protocol.
+	StreamWindow uint32
+
+	// WriteBufferSize is the size of the buffer where handlers write frames
+	// before flushing them. If zero, we use 1 MiB.
+	WriteBufferSize int
+}
+
+// Serve accepts and serves connections until the listener is closed.
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn serves the given connection until the client closes it.
+func (s *Server) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	slog.Info("accepted", slog.String("remoteAddr", conn.RemoteAddr().String()))
+
+	ctx := context.Background()
+	if s.ConnContext != nil {
+		ctx = s.ConnContext(ctx, conn)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sc := newServerConn(ctx, s, conn)
+	err := sc.serve()
+	sc.close()
+	slog.Info("closed", slog.String("remoteAddr", conn.RemoteAddr().String()), slog.Any("err", err))
+}
+
+// serverConn is the server side of an HTTP/2 connection.
+type serverConn struct {
+	// br is the buffered reader from which we read frames.
+	br *bufio.Reader
+
+	// bw is the buffered writer to which handlers write frames.
+	bw *bufio.Writer
+
+	// cond is signaled when the send windows or the settings change.
+	cond *sync.Cond
+
+	// conn is the underlying connection.
+	conn net.Conn
+
+	// connUnacked is the number of consumed bytes for which we have
+	// not yet sent a connection-level WINDOW_UPDATE.
+	connUnacked int64
+
+	// connWindow is the connection-level send window.
+	connWindow int64
+
+	// ctx is the connection context.
+	ctx context.Context
+
+	// done indicates that the connection is closed.
+	done bool
+
+	// encbuf is the buffer used by encoder.
+	encbuf *bytes.Buffer
+
+	// encoder is the HPACK encoder.
+	encoder *hpack.Encoder
+
+	// framer reads and writes frames.
+	framer *http2.Framer
+
+	// initialWindow is the peer's SETTINGS_INITIAL_WINDOW_SIZE.
+	initialWindow int64
+
+	// maxFrameSize is the peer's SETTINGS_MAX_FRAME_SIZE.
+	maxFrameSize int64
+
+	// mu protects the send windows, the settings, streams, and done.
+	mu sync.Mutex
+
+	// srv is the server that owns this connection.
+	srv *Server
+
+	// streams maps the open stream IDs to the corresponding streams.
+	streams map[uint32]*stream
+
+	// wg tracks the handler goroutines.
+	wg sync.WaitGroup
+
+	// wmu serializes writing frames, and protects encoder and encbuf.
+	wmu sync.Mutex
+}
+
+func newServerConn(ctx context.Context, srv *Server, conn net.Conn) *serverConn {
+	bufsiz := srv.WriteBufferSize
+	if bufsiz <= 0 {
+		bufsiz = 1 << 20
+	}
+	br, bw, encbuf := bufio.NewReader(conn), bufio.NewWriterSize(conn, bufsiz), &bytes.Buffer{}
+	framer := http2.NewFramer(bw, br)
+	framer.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	framer.SetMaxReadFrameSize(srv.maxReadFrameSize())
+	sc := &serverConn{
+		br:            br,
+		bw:            bw,
+		conn:          conn,
+		connWindow:    initialWindowSize,
+		ctx:           ctx,
+		encbuf:        encbuf,
+		encoder:       hpack.NewEncoder(encbuf),
+		framer:        framer,
+		initialWindow: initialWindowSize,
+		maxFrameSize:  initialMaxFrameSize,
+		srv:           srv,
+		streams:       map[uint32]*stream{},
+	}
+	sc.cond = sync.NewCond(&sc.mu)
+	return sc
+}
+
+// connWindow returns the configured connection-level receive window.
+func (s *Server) connWindow() int64 {
+	if s.ConnWindow <= 0 {
+		return maxWindowSize
+	}
+	return int64(s.ConnWindow)
+}
+
+// streamWindow returns the configured stream-level receive window.
+func (s *Server) streamWindow() int64 {
+	if s.StreamWindow <= 0 {
+		return maxWindowSize
+	}
+	return int64(s.StreamWindow)
+}
+
+// maxReadFrameSize returns the configured maximum frame size.
+func (s *Server) maxReadFrameSize() uint32 {
+	if s.MaxReadFrameSize <= 0 {
+		return maxFrameSize
+	}
+	return s.MaxReadFrameSize
+}
+
+// serve reads and handles frames until the client closes the connection.
+func (sc *serverConn) serve() error {
+	preface := make([]byte, len(http2.ClientPreface))
+	if _, err := io.ReadFull(sc.br, preface); err != nil {
+		return err
+	}
+	if string(preface) != http2.ClientPreface {
+		return errors.New("h2mw: invalid client preface")
+	}
+	err := sc.write(func() error {
+		err := sc.framer.WriteSettings(
+			http2.Setting{ID: http2.SettingInitialWindowSize, Val: uint32(sc.srv.streamWindow())},
+			http2.Setting{ID: http2.SettingMaxFrameSize, Val: sc.srv.maxReadFrameSize()},
+		)
+		if err != nil {
+			return err
+		}
+		if increment := sc.srv.connWindow() - initialWindowSize; increment > 0 {
+			return sc.framer.WriteWindowUpdate(0, uint32(increment))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		frame, err := sc.framer.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch frame := frame.(type) {
+		case *http2.DataFrame:
+			err = sc.handleData(frame)
+		case *http2.GoAwayFrame:
+			return nil
+		case *http2.MetaHeadersFrame:
+			sc.handleHeaders(frame)
+		case *http2.PingFrame:
+			if !frame.IsAck() {
+				err = sc.write(func() error { return sc.framer.WritePing(true, frame.Data) })
+			}
+		case *http2.RSTStreamFrame:
+			sc.resetStream(frame.StreamID)
+		case *http2.SettingsFrame:
+			err = sc.handleSettings(frame)
+		case *http2.WindowUpdateFrame:
+			sc.handleWindowUpdate(frame)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// close marks the connection as closed and waits for the handlers.
+func (sc *serverConn) close() {
+	sc.mu.Lock()
+	sc.done = true
+	for _, st := range sc.streams {
+		st.reset()
+	}
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+	sc.wg.Wait()
+}
+
+// handleData delivers the DATA frame to the corresponding request body.
+func (sc *serverConn) handleData(frame *http2.DataFrame) error {
+	sc.mu.Lock()
+	st := sc.streams[frame.StreamID]
+	sc.mu.Unlock()
+
+	// Immediately give back the bytes we are not going to buffer.
+	unbuffered := int64(frame.Length)
+	if st != nil && st.body.deliver(frame.Data(), frame.StreamEnded()) {
+		unbuffered -= int64(len(frame.Data()))
+	}
+	return sc.consumed(nil, unbuffered)
+}
+
+// handleHeaders starts a handler for a new request or handles the
+// trailers of an existing request.
+func (sc *serverConn) handleHeaders(frame *http2.MetaHeadersFrame) {
+	sc.mu.Lock()
+	if st := sc.streams[frame.StreamID]; st != nil {
+		sc.mu.Unlock()
+		st.body.deliver(nil, frame.StreamEnded())
+		return
+	}
+	st := newStream(sc, frame)
+	sc.streams[frame.StreamID] = st
+	sc.mu.Unlock()
+
+	sc.wg.Go(st.serve)
+}
+
+// handleSettings applies and acknowledges the client settings.
+func (sc *serverConn) handleSettings(frame *http2.SettingsFrame) error {
+	if frame.IsAck() {
+		return nil
+	}
+	sc.mu.Lock()
+	frame.ForeachSetting(func(setting http2.Setting) error {
+		switch setting.ID {
+		case http2.SettingInitialWindowSize:
+			delta := int64(setting.Val) - sc.initialWindow
+			for _, st := range sc.streams {
+				st.window += delta
+			}
+			sc.initialWindow = int64(setting.Val)
+		case http2.SettingMaxFrameSize:
+			sc.maxFrameSize = int64(setting.Val)
+		}
+		return nil
+	})
+	sc.cond.Broadcast()
+	sc.mu.Unlock()
+
+	return sc.write(func() error { return sc.framer.WriteSettingsAck() })
+}
+
+// handleWindowUpdate increments the corresponding send window.
+func (sc *serverConn) handleWindowUpdate(frame *http2.WindowUpdateFrame) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if frame.StreamID == 0 {
+		sc.connWindow += int64(frame.Increment)
+	} else if st := sc.streams[frame.StreamID]; st != nil {
+		st.window += int64(frame.Increment)
+	}
+	sc.cond.Broadcast()
+}
+
+// resetStream handles the client resetting the given stream.
+func (sc *serverConn) resetStream(streamID uint32) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if st := sc.streams[streamID]; st != nil {
+		st.reset()
+		delete(sc.streams, streamID)
+	}
+	sc.cond.Broadcast()
+}
+
+// closeStream forgets about the given stream once its handler is done.
+func (sc *serverConn) closeStream(st *stream) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.streams[st.id] == st {
+		delete(sc.streams, st.id)
+	}
+}
+
+// consumed sends WINDOW_UPDATE frames once we have consumed half of the
+// stream-level or connection-level receive window. A nil stream only
+// accounts for the connection-level window.
+func (sc *serverConn) consumed(st *stream, count int64) error {
+	if count <= 0 {
+		return nil
+	}
+	sc.mu.Lock()
+	var connIncrement, streamIncrement int64
+	sc.connUnacked += count
+	if sc.connUnacked >= sc.srv.connWindow()/2 {
+		connIncrement, sc.connUnacked = sc.connUnacked, 0
+	}
+	if st != nil {
+		st.unacked += count
+		if st.unacked >= sc.srv.streamWindow()/2 {
+			streamIncrement, st.unacked = st.unacked, 0
+		}
+	}
+	sc.mu.Unlock()
+
+	if connIncrement <= 0 && streamIncrement <= 0 {
+		return nil
+	}
+	return sc.write(func() error {
+		if connIncrement > 0 {
+			if err := sc.framer.WriteWindowUpdate(0, uint32(connIncrement)); err != nil {
+				return err
+			}
+		}
+		if streamIncrement > 0 {
+			return sc.framer.WriteWindowUpdate(st.id, uint32(streamIncrement))
+		}
+		return nil
+	})
+}
+
+// reserve waits for the send windows to allow sending and reserves up
+// to count bytes for the given stream. It also returns the maximum frame
+// size. Before blocking, it flushes the buffered frames, since the client
+// may be waiting for them before sending us WINDOW_UPDATE frames.
+func (sc *serverConn) reserve(st *stream, count int64) (int64, int64, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	flushed := false
+	for {
+		if sc.done || st.isReset {
+			return 0, 0, errors.New("h2mw: stream closed")
+		}
+		if sc.connWindow > 0 && st.window > 0 {
+			n := min(count, sc.connWindow, st.window)
+			sc.connWindow -= n
+			st.window -= n
+			return n, sc.maxFrameSize, nil
+		}
+		if !flushed {
+			sc.mu.Unlock()
+			err := sc.write(func() error { return nil })
+			sc.mu.Lock()
+			if err != nil {
+				return 0, 0, err
+			}
+			flushed = true
+			continue
+		}
+		sc.cond.Wait()
+	}
+}
+
+// write calls fn while holding the write lock and then flushes.
+func (sc *serverConn) write(fn func() error) error {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	if err := fn(); err != nil {
+		return err
+	}
+	return sc.bw.Flush()
+}
+
+// writeHeaders writes a HEADERS frame containing the given fields.
+func (sc *serverConn) writeHeaders(streamID uint32, endStream bool, fields []hpack.HeaderField) error {
+	return sc.write(func() error {
+		sc.encbuf.Reset()
+		for _, field := range fields {
+			if err := sc.encoder.WriteField(field); err != nil {
+				return err
+			}
+		}
+		return sc.framer.WriteHeaders(http2.HeadersFrameParam{
+			StreamID:      streamID,
+			BlockFragment: sc.encbuf.Bytes(),
+			EndStream:     endStream,
+			EndHeaders:    true,
+		})
+	})
+}
@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package h2mw
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// stream is an HTTP/2 stream and implements [http.ResponseWriter].
+type stream struct {
+	// body is the request body.
+	body *requestBody
+
+	// cancel cancels the request context.
+	cancel context.CancelFunc
+
+	// err is the sticky error that occurred writing the response.
+	err error
+
+	// header contains the response headers and trailers.
+	header http.Header
+
+	// id is the stream ID.
+	id uint32
+
+	// isReset indicates that the stream has been reset (protected by sc.mu).
+	isReset bool
+
+	// req is the request or nil if the request is malformed.
+	req *http.Request
+
+	// sc is the connection that owns the stream.
+	sc *serverConn
+
+	// trailers contains the trailers declared using the Trailer header.
+	trailers []string
+
+	// unacked is the number of consumed bytes for which we have not
+	// yet sent a stream-level WINDOW_UPDATE (protected by sc.mu).
+	unacked int64
+
+	// window is the stream-level send window (protected by sc.mu).
+	window int64
+
+	// wroteHeader indicates that we have written the response headers.
+	wroteHeader bool
+}
+
+var (
+	_ http.Flusher        = &stream{}
+	_ http.ResponseWriter = &stream{}
+)
+
+// newStream creates a new stream. The caller must hold sc.mu.
+func newStream(sc *serverConn, frame *http2.MetaHeadersFrame) *stream {
+	ctx, cancel := context.WithCancel(sc.ctx)
+	st := &stream{
+		cancel: cancel,
+		header: http.Header{},
+		id:     frame.StreamID,
+		sc:     sc,
+		window: sc.initialWindow,
+	}
+	st.body = &requestBody{st: st}
+	st.body.cond = sync.NewCond(&st.body.mu)
+	if frame.StreamEnded() {
+		st.body.deliver(nil, true)
+	}
+
+	path := frame.PseudoValue("path")
+	URL, err := url.ParseRequestURI(path)
+	if err != nil {
+		return st
+	}
+	header := http.Header{}
+	for _, field := range frame.RegularFields() {
+		header.Add(field.Name, field.Value)
+	}
+	contentLength := int64(-1)
+	if frame.StreamEnded() {
+		contentLength = 0
+	} else if value, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64); err == nil && value >= 0 {
+		contentLength = value
+	}
+	st.req = (&http.Request{
+		Body:          st.body,
+		ContentLength: contentLength,
+		Header:        header,
+		Host:          frame.PseudoValue("authority"),
+		Method:        frame.PseudoValue("method"),
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		RemoteAddr:    sc.conn.RemoteAddr().String(),
+		RequestURI:    path,
+		URL:           URL,
+	}).WithContext(ctx)
+	return st
+}
+
+// serve runs the handler and then ends the stream.
+func (st *stream) serve() {
+	defer st.sc.closeStream(st)
+	defer st.cancel()
+
+	if st.req == nil {
+		st.WriteHeader(http.StatusBadRequest)
+	} else {
+		st.sc.srv.Handler.ServeHTTP(st, st.req)
+	}
+	err := st.finish()
+
+	// Like net/http, reset the stream if the client is still sending.
+	if eof := st.body.close(); err == nil && !eof {
+		st.sc.write(func() error { return st.sc.framer.WriteRSTStream(st.id, http2.ErrCodeNo) })
+	}
+}
+
+// reset handles the stream being reset. The caller must hold sc.mu.
+func (st *stream) reset() {
+	st.isReset = true
+	st.cancel()
+	st.body.fail(errors.New("h2mw: stream reset"))
+}
+
+// Header implements [http.ResponseWriter].
+func (st *stream) Header() http.Header {
+	return st.header
+}
+
+// WriteHeader implements [http.ResponseWriter].
+func (st *stream) WriteHeader(statusCode int) {
+	if st.wroteHeader {
+		return
+	}
+	st.wroteHeader = true
+
+	for _, value := range st.header.Values("Trailer") {
+		for name := range strings.SplitSeq(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				st.trailers = append(st.trailers, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	fields := []hpack.HeaderField{{Name: ":status", Value: strconv.Itoa(statusCode)}}
+	for _, key := range slices.Sorted(maps.Keys(st.header)) {
+		if isConnectionHeader(key) || strings.HasPrefix(key, http.TrailerPrefix) {
+			continue
+		}
+		for _, value := range st.header[key] {
+			fields = append(fields, hpack.HeaderField{Name: strings.ToLower(key), Value: value})
+		}
+	}
+	st.err = st.sc.writeHeaders(st.id, false, fields)
+}
+
+// Write implements [http.ResponseWriter].
+//
+// We write as many DATA frames as the send windows permit while holding
+// the write lock and then flush them using a single write.
+func (st *stream) Write(data []byte) (int, error) {
+	if !st.wroteHeader {
+		st.WriteHeader(http.StatusOK)
+	}
+	var count int
+	for st.err == nil && len(data) > 0 {
+		var n, frameSize int64
+		n, frameSize, st.err = st.sc.reserve(st, int64(len(data)))
+		if st.err != nil {
+			break
+		}
+		st.err = st.sc.write(func() error {
+			for chunk := data[:n]; len(chunk) > 0; {
+				size := min(int64(len(chunk)), frameSize)
+				if err := st.sc.framer.WriteData(st.id, false, chunk[:size]); err != nil {
+					return err
+				}
+				chunk = chunk[size:]
+			}
+			return nil
+		})
+		if st.err == nil {
+			count += int(n)
+			data = data[n:]
+		}
+	}
+	return count, st.err
+}
+
+// Flush implements [http.Flusher]. Since [*stream.Write] flushes
+// before returning, here we only need to send the headers.
+func (st *stream) Flush() {
+	if !st.wroteHeader {
+		st.WriteHeader(http.StatusOK)
+	}
+}
+
+// finish ends the stream, sending the trailers, if any.
+func (st *stream) finish() error {
+	if !st.wroteHeader {
+		st.WriteHeader(http.StatusOK)
+	}
+	if st.err != nil {
+		return st.err
+	}
+
+	var fields []hpack.HeaderField
+	for _, name := range st.trailers {
+		for _, value := range st.header.Values(name) {
+			fields = append(fields, hpack.HeaderField{Name: strings.ToLower(name), Value: value})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(st.header)) {
+		if name, ok := strings.CutPrefix(key, http.TrailerPrefix); ok {
+			for _, value := range st.header[key] {
+				fields = append(fields, hpack.HeaderField{Name: strings.ToLower(name), Value: value})
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return st.sc.writeHeaders(st.id, true, fields)
+	}
+	return st.sc.write(func() error { return st.sc.framer.WriteData(st.id, true, nil) })
+}
+
+// isConnectionHeader returns whether the header is connection-specific
+// and therefore forbidden in HTTP/2 (see RFC 9113 Section 8.2.2).
+func isConnectionHeader(key string) bool {
+	switch key {
+	case "Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade":
+		return true
+	default:
+		return false
+	}
+}
+
+// requestBody is the request body, which buffers the DATA frames
+// received by the reader goroutine until the handler reads them.
+type requestBody struct {
+	// buf contains the data not read yet.
+	buf bytes.Buffer
+
+	// closed indicates that the handler closed the body.
+	closed bool
+
+	// cond is signaled when data arrives or err is set.
+	cond *sync.Cond
+
+	// err is io.EOF after END_STREAM or the error that occurred.
+	err error
+
+	// mu protects all the other fields.
+	mu sync.Mutex
+
+	// st is the stream that owns the body.
+	st *stream
+}
+
+var _ io.ReadCloser = &requestBody{}
+
+// deliver buffers data and returns whether it did so.
+func (b *requestBody) deliver(data []byte, endStream bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buffered := !b.closed && b.err == nil
+	if buffered {
+		b.buf.Write(data)
+	}
+	if endStream && b.err == nil {
+		b.err = io.EOF
+	}
+	b.cond.Broadcast()
+	return buffered
+}
+
+// fail makes reading fail with err once the buffered data has been read.
+func (b *requestBody) fail(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err == nil {
+		b.err = err
+	}
+	b.cond.Broadcast()
+}
+
+// Read implements [io.Reader].
+func (b *requestBody) Read(data []byte) (int, error) {
+	b.mu.Lock()
+	for b.buf.Len() <= 0 && b.err == nil {
+		b.cond.Wait()
+	}
+	if b.buf.Len() <= 0 {
+		err := b.err
+		b.mu.Unlock()
+		return 0, err
+	}
+	count, _ := b.buf.Read(data)
+	b.mu.Unlock()
+
+	return count, b.st.sc.consumed(b.st, int64(count))
+}
+
+// Close implements [io.Closer].
+func (b *requestBody) Close() error {
+	b.close()
+	return nil
+}
+
+// close discards the buffered data, giving back the connection-level
+// window, and returns whether we received END_STREAM.
+func (b *requestBody) close() bool {
+	b.mu.Lock()
+	eof := b.err == io.EOF
+	pending := int64(b.buf.Len())
+	b.buf.Reset()
+	b.closed = true
+	if b.err == nil {
+		b.err = errors.New("h2mw: body closed")
+	}
+	b.cond.Broadcast()
+	b.mu.Unlock()
+
+	b.st.sc.consumed(nil, pending)
+	return eof
+}
@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package linkemu
+
+import (
+	"bytes"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// chunkSize is the largest write we send through the link as a unit,
+// which bounds the granularity of the queue accounting.
+const chunkSize = 16 << 10
+
+// closeLinger is how long Close waits for the delivery of the bytes in
+// flight after their expected delivery time before giving up.
+const closeLinger = time.Second
+
+// unlimitedPending bounds the bytes in flight when the rate is unlimited,
+// since otherwise a fast writer could make them grow without bound.
+const unlimitedPending = 64 << 20
+
+// chunk is a write in flight on the emulated link.
+type chunk struct {
+	data    []byte
+	deliver time.Time
+}
+
+// emuConn is the [net.Conn] returned by [*Config.Conn].
+//
+// Writes enter the queue, which the link drains at its rate. Each chunk
+// then reaches the delivery goroutine, which writes it to the underlying
+// [net.Conn] once the one-way delay has elapsed.
+type emuConn struct {
+	net.Conn
+	closing chan struct{}
+	config  *Config
+	done    chan struct{}
+	limit   int64
+	queue   int64
+	writeMu sync.Mutex // serializes the writers
+
+	mu      sync.Mutex
+	busy    time.Time // when the link has sent all the queued bytes
+	closed  bool
+	cond    *sync.Cond // signaled when the state below changes
+	err     error
+	last    time.Time // delivery time of the last chunk
+	pending []chunk
+	size    int64 // bytes in pending
+}
+
+// newConn constructs a new [*emuConn] and starts delivering.
+func newConn(conn net.Conn, config *Config) *emuConn {
+	c := &emuConn{
+		Conn:    conn,
+		closing: make(chan struct{}),
+		config:  config,
+		done:    make(chan struct{}),
+		limit:   unlimitedPending,
+		queue:   config.queue(),
+	}
+	if config.Rate > 0 {
+		// The queue, the bytes propagating, and those waiting for a
+		// retransmission with [DropTail], which takes two more delays.
+		c.limit = c.queue + c.bytes(3*config.Delay) + chunkSize
+	}
+	c.cond = sync.NewCond(&c.mu)
+	go c.deliverLoop()
+	return c
+}
+
+// NetConn returns the underlying [net.Conn], like [*tls.Conn] does.
+func (c *emuConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+// Write implements [net.Conn]. It returns once the link has queued the
+// bytes, so the deadlines only apply to the delivery.
+func (c *emuConn) Write(data []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	var count int
+	for len(data) > 0 {
+		size := min(len(data), chunkSize)
+		if err := c.send(data[:size]); err != nil {
+			return count, err
+		}
+		count += size
+		data = data[size:]
+	}
+	return count, nil
+}
+
+// send sends a chunk through the link.
+func (c *emuConn) send(data []byte) error {
+	size := int64(len(data))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var lost bool
+	for {
+		if c.err != nil {
+			return c.err
+		}
+		if c.closed {
+			return net.ErrClosed
+		}
+		if c.size+size > c.limit {
+			c.cond.Wait()
+			continue
+		}
+		backlog := c.bytes(time.Until(c.busy))
+		excess := backlog + size - c.queue
+		if c.config.Rate <= 0 || excess <= 0 {
+			break
+		}
+		if c.config.Drop == DropTail {
+			// Emulate the sender backing off after the loss by waiting
+			// for the queue to drain before retransmitting.
+			lost, excess = true, backlog
+		}
+		c.mu.Unlock()
+		err := c.sleep(c.transmit(excess))
+		c.mu.Lock()
+		if err != nil {
+			return err
+		}
+	}
+
+	start := later(time.Now(), c.busy)
+	c.busy = start.Add(c.transmit(size))
+	deliver := c.busy.Add(c.config.Delay)
+	if lost {
+		deliver = deliver.Add(2 * c.config.Delay)
+	}
+	c.last = later(deliver, c.last)
+	c.pending = append(c.pending, chunk{data: bytes.Clone(data), deliver: c.last})
+	c.size += size
+	c.cond.Broadcast()
+	return nil
+}
+
+// sleep sleeps for the given duration unless we are closing.
+func (c *emuConn) sleep(duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-c.closing:
+		return net.ErrClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+// deliverLoop writes the pending chunks to the underlying [net.Conn]
+// once due, until we are closed and there are no pending chunks.
+func (c *emuConn) deliverLoop() {
+	defer close(c.done)
+	for {
+		c.mu.Lock()
+		for len(c.pending) <= 0 && !c.closed {
+			c.cond.Wait()
+		}
+		if len(c.pending) <= 0 {
+			c.mu.Unlock()
+			return
+		}
+		due := c.pending[0].deliver
+		c.mu.Unlock()
+
+		time.Sleep(time.Until(due))
+
+		c.mu.Lock()
+		var (
+			buffers net.Buffers
+			size    int64
+			now     = time.Now()
+		)
+		for len(c.pending) > 0 && !c.pending[0].deliver.After(now) {
+			buffers = append(buffers, c.pending[0].data)
+			size += int64(len(c.pending[0].data))
+			c.pending = c.pending[1:]
+		}
+		c.mu.Unlock()
+
+		_, err := buffers.WriteTo(c.Conn)
+
+		c.mu.Lock()
+		c.size -= size
+		if err != nil {
+			c.err = err
+			c.pending, c.size = nil, 0
+		}
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close implements [net.Conn]. It waits for the delivery of the bytes in
+// flight, like closing a socket does not discard the unsent bytes.
+func (c *emuConn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return c.Conn.Close()
+	}
+	c.closed = true
+	close(c.closing)
+	linger := time.Until(c.last) + closeLinger
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	timer := time.NewTimer(linger)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+	case <-timer.C:
+	}
+	return c.Conn.Close()
+}
+
+// bytes returns the bytes the link sends in the given duration.
+func (c *emuConn) bytes(duration time.Duration) int64 {
+	if duration <= 0 || c.config.Rate <= 0 {
+		return 0
+	}
+	return int64(duration.Seconds() * float64(c.config.Rate) / 8)
+}
+
+// transmit returns the time the link takes to send size bytes.
+func (c *emuConn) transmit(size int64) time.Duration {
+	if size <= 0 || c.config.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(float64(size) * 8 * float64(time.Second) / float64(c.config.Rate)))
+}
+
+// later returns the later of two times.
+func later(t1, t2 time.Time) time.Time {
+	if t1.After(t2) {
+		return t1
+	}
+	return t2
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package linkemu emulates a bottleneck link in userspace by wrapping
+// [net.Conn] and [net.Listener], for experiments without root or tc.
+//
+// The emulation applies to the bytes each side writes, so enabling it
+// on both the client and the server shapes both directions, each with
+// the configured one-way delay, while enabling it on a single side only
+// shapes the direction in which that side sends.
+//
+// Because we wrap a reliable stream, we cannot lose bytes: the [DropTail]
+// policy emulates a loss by delaying the dropped bytes by the time TCP
+// needs to retransmit them. Also, the kernel does not see the emulated
+// link, so the TCP_INFO samples describe the underlying connection.
+package linkemu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/bassosimone/vflag"
+)
+
+// DropPolicy is what the link does with the bytes exceeding the queue.
+type DropPolicy string
+
+const (
+	// DropBlock blocks the writer until there is room in the queue, like
+	// a lossless link pushing back on the sender.
+	DropBlock = DropPolicy("block")
+
+	// DropTail drops the bytes exceeding the queue and delivers them once
+	// retransmitted, i.e., two one-way delays later, while the bytes that
+	// follow wait for them because the stream is in order. Like a sender
+	// backing off after a loss, the writer then waits for the queue to drain.
+	DropTail = DropPolicy("tail")
+)
+
+// defaultQueueLatency is the queue size, expressed as the time to drain
+// it at the link rate, when the [*Config] does not specify it.
+const defaultQueueLatency = 50 * time.Millisecond
+
+// Config contains the emulated link settings.
+//
+// A nil [*Config] disables the emulation.
+type Config struct {
+	// Delay is the one-way propagation delay.
+	Delay time.Duration
+
+	// Drop is the policy when the queue is full.
+	Drop DropPolicy
+
+	// Queue is the size of the queue in front of the link in bytes,
+	// which is zero to use the bytes the link sends in 50 ms.
+	Queue int64
+
+	// Rate is the link rate in bit/s, which is zero for unlimited.
+	Rate int64
+}
+
+// Log logs the settings, which the commands do at startup.
+func (c *Config) Log() {
+	if c == nil {
+		return
+	}
+	slog.Info("linkemu",
+		slog.Duration("delay", c.Delay),
+		slog.String("drop", string(c.Drop)),
+		slog.Int64("queue", c.queue()),
+		slog.Int64("rate", c.Rate),
+	)
+}
+
+// queue returns the queue size in bytes.
+func (c *Config) queue() int64 {
+	if c.Rate <= 0 {
+		return 0
+	}
+	queue := c.Queue
+	if queue <= 0 {
+		queue = int64(defaultQueueLatency.Seconds() * float64(c.Rate) / 8)
+	}
+	// A queue smaller than a chunk could never admit it.
+	return max(queue, chunkSize)
+}
+
+// Conn returns conn sending through the emulated link.
+func (c *Config) Conn(conn net.Conn) net.Conn {
+	if c == nil {
+		return conn
+	}
+	return newConn(conn, c)
+}
+
+// DialContext returns dial with the dialed connections sending
+// through the emulated link.
+func (c *Config) DialContext(
+	dial func(ctx context.Context, network, address string) (net.Conn, error),
+) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if c == nil {
+		return dial
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		return c.Conn(conn), nil
+	}
+}
+
+// Listener returns listener with the accepted connections sending
+// through the emulated link.
+func (c *Config) Listener(listener net.Listener) net.Listener {
+	if c == nil {
+		return listener
+	}
+	return &emuListener{Listener: listener, config: c}
+}
+
+// emuListener is the [net.Listener] returned by [*Config.Listener].
+type emuListener struct {
+	net.Listener
+	config *Config
+}
+
+// Accept implements [net.Listener].
+func (l *emuListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.config.Conn(conn), nil
+}
+
+// Flags contains the link emulation flags.
+type Flags struct {
+	// Delay is the one-way delay.
+	Delay time.Duration
+
+	// Drop is the drop policy, which is empty for [DropBlock].
+	Drop string
+
+	// Queue is the queue size in bytes.
+	Queue int64
+
+	// Rate is the link rate in Mbit/s.
+	Rate float64
+}
+
+// AddFlags adds the link emulation flags to the given [*vflag.FlagSet].
+func (f *Flags) AddFlags(fset *vflag.FlagSet) {
+	fset.DurationVar(&f.Delay, 0, "link-delay", "Emulate a link with a one-way delay of `DELAY`.")
+	fset.StringVar(&f.Drop, 0, "link-drop", "Use the given `POLICY` when the link queue is full (block, tail).")
+	fset.Int64Var(&f.Queue, 0, "link-queue", "Use a link queue of `BYTES` (default: 50 ms at the link rate).")
+	fset.Float64Var(&f.Rate, 0, "link-rate", "Emulate a link of `MBITS` Mbit/s.")
+}
+
+// Config returns the [*Config] or nil when the flags do not enable the
+// emulation, i.e., when they set neither a delay nor a rate.
+func (f *Flags) Config() (*Config, error) {
+	if f.Delay < 0 || f.Queue < 0 || f.Rate < 0 {
+		return nil, errors.New("linkemu: negative delay, queue, or rate")
+	}
+	drop := DropPolicy(f.Drop)
+	switch drop {
+	case "":
+		drop = DropBlock
+	case DropBlock, DropTail:
+	default:
+		return nil, fmt.Errorf("linkemu: unknown drop policy %q", f.Drop)
+	}
+	if f.Delay <= 0 && f.Rate <= 0 {
+		return nil, nil
+	}
+	config := &Config{
+		Delay: f.Delay,
+		Drop:  drop,
+		Queue: f.Queue,
+		Rate:  int64(f.Rate * 1e6),
+	}
+	config.Log()
+	return config, nil
+}
@@ -0,0 +1,237 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package linkemu
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// received is what [startReader] observes on the receiving side.
+type received struct {
+	count int64
+	err   error
+	first time.Time
+	last  time.Time
+}
+
+// startReader reads from conn until EOF and returns a channel
+// that receives what it observed once done.
+func startReader(conn net.Conn) <-chan *received {
+	ch := make(chan *received, 1)
+	go func() {
+		result := &received{}
+		buf := make([]byte, 1<<16)
+		for {
+			count, err := conn.Read(buf)
+			if count > 0 {
+				if result.count <= 0 {
+					result.first = time.Now()
+				}
+				result.count += int64(count)
+				result.last = time.Now()
+			}
+			if err != nil {
+				if err != io.EOF {
+					result.err = err
+				}
+				ch <- result
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// newTestConn returns a [net.Conn] sending through the link emulated using
+// config and a channel receiving what the peer observes.
+func newTestConn(t *testing.T, config *Config) (net.Conn, <-chan *received) {
+	left, right := net.Pipe()
+	t.Cleanup(func() { right.Close() })
+	conn := config.Conn(left)
+	t.Cleanup(func() { conn.Close() })
+	return conn, startReader(right)
+}
+
+func TestConnRate(t *testing.T) {
+	const size = 2 << 20
+	config := &Config{Drop: DropBlock, Rate: 80e6} // 10 MB/s
+	conn, ch := newTestConn(t, config)
+	t0 := time.Now()
+	if _, err := conn.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	result := <-ch
+	if result.err != nil || result.count != size {
+		t.Fatalf("received %d bytes with err %v", result.count, result.err)
+	}
+	elapsed := result.last.Sub(t0)
+	speed := float64(size) * 8 / elapsed.Seconds()
+	if speed < 0.7*float64(config.Rate) || speed > 1.1*float64(config.Rate) {
+		t.Fatalf("speed %.0f bit/s, want about %d bit/s", speed, config.Rate)
+	}
+}
+
+func TestConnDelay(t *testing.T) {
+	const delay = 100 * time.Millisecond
+	conn, ch := newTestConn(t, &Config{Delay: delay, Drop: DropBlock})
+	t0 := time.Now()
+	if _, err := conn.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(t0); elapsed >= delay/2 {
+		t.Fatalf("Write took %v, want it to return before the delivery", elapsed)
+	}
+	conn.Close()
+	result := <-ch
+	if result.count != 1 {
+		t.Fatalf("received %d bytes, want 1", result.count)
+	}
+	if elapsed := result.first.Sub(t0); elapsed < delay || elapsed > 3*delay {
+		t.Fatalf("first byte after %v, want about %v", elapsed, delay)
+	}
+}
+
+func TestConnDropBlock(t *testing.T) {
+	const (
+		queue = 64 << 10
+		size  = 256 << 10
+	)
+	config := &Config{Drop: DropBlock, Queue: queue, Rate: 8e6} // 1 MB/s
+	conn, ch := newTestConn(t, config)
+	t0 := time.Now()
+	if _, err := conn.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	// The writer blocks until the bytes exceeding the queue enter the link.
+	want := time.Duration(float64(size-queue) * 8 / float64(config.Rate) * float64(time.Second))
+	if elapsed := time.Since(t0); elapsed < want*3/4 {
+		t.Fatalf("Write returned after %v, want about %v", elapsed, want)
+	}
+	conn.Close()
+	if result := <-ch; result.count != size {
+		t.Fatalf("received %d bytes, want %d", result.count, size)
+	}
+}
+
+func TestConnDropTail(t *testing.T) {
+	const delay = 50 * time.Millisecond
+
+	// arrival returns when the last of two chunks arrives, where the second
+	// one does not fit into the queue, which only contains a chunk.
+	arrival := func(drop DropPolicy) time.Duration {
+		conn, ch := newTestConn(t, &Config{Delay: delay, Drop: drop, Queue: chunkSize, Rate: 8e6})
+		t0 := time.Now()
+		if _, err := conn.Write(make([]byte, 2*chunkSize)); err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		result := <-ch
+		if result.count != 2*chunkSize {
+			t.Fatalf("received %d bytes, want %d", result.count, 2*chunkSize)
+		}
+		return result.last.Sub(t0)
+	}
+
+	// With DropBlock, the second chunk waits for the first and then propagates,
+	// while with DropTail it also waits for the retransmission.
+	block, tail := arrival(DropBlock), arrival(DropTail)
+	if block >= 3*delay {
+		t.Fatalf("DropBlock: last byte after %v, want less than %v", block, 3*delay)
+	}
+	if tail < 3*delay || tail-block < delay {
+		t.Fatalf("DropTail: last byte after %v, want at least %v more than %v", tail, 2*delay, block)
+	}
+}
+
+func TestConnCloseFlushes(t *testing.T) {
+	const size = 256 << 10
+	conn, ch := newTestConn(t, &Config{Delay: 100 * time.Millisecond, Drop: DropBlock, Rate: 80e6})
+	if _, err := conn.Write(make([]byte, size)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if result := <-ch; result.err != nil || result.count != size {
+		t.Fatalf("received %d bytes with err %v, want %d", result.count, result.err, size)
+	}
+	if _, err := conn.Write([]byte("x")); err == nil {
+		t.Fatal("expected Write to fail after Close")
+	}
+}
+
+func TestNilConfig(t *testing.T) {
+	left, right := net.Pipe()
+	defer left.Close()
+	defer right.Close()
+	var config *Config
+	if conn := config.Conn(left); conn != left {
+		t.Fatal("expected a nil *Config to return the same conn")
+	}
+}
+
+func TestFlagsConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		flags   Flags
+		want    *Config
+		wantErr bool
+	}{
+		{name: "disabled", flags: Flags{}, want: nil},
+		{name: "queue only", flags: Flags{Queue: 1 << 20}, want: nil},
+		{name: "drop only", flags: Flags{Drop: "tail"}, want: nil},
+		{
+			name:  "delay",
+			flags: Flags{Delay: 10 * time.Millisecond},
+			want:  &Config{Delay: 10 * time.Millisecond, Drop: DropBlock},
+		},
+		{
+			name:  "rate",
+			flags: Flags{Drop: "tail", Queue: 1 << 20, Rate: 2.5},
+			want:  &Config{Drop: DropTail, Queue: 1 << 20, Rate: 2500000},
+		},
+		{name: "negative delay", flags: Flags{Delay: -time.Second}, wantErr: true},
+		{name: "negative queue", flags: Flags{Queue: -1, Rate: 1}, wantErr: true},
+		{name: "negative rate", flags: Flags{Rate: -1}, wantErr: true},
+		{name: "unknown policy", flags: Flags{Drop: "red", Rate: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.flags.Config()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Config() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Fatalf("Config() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigQueue(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   int64
+	}{
+		{"unlimited rate", Config{Queue: 1 << 20}, 0},
+		{"default", Config{Rate: 80e6}, 500000}, // 50 ms at 10 MB/s
+		{"configured", Config{Queue: 1 << 20, Rate: 80e6}, 1 << 20},
+		{"at least a chunk", Config{Queue: 1, Rate: 80e6}, chunkSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.queue(); got != tt.want {
+				t.Fatalf("queue() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package profiling implements the profiling flags shared by the
+// serve and measure commands.
+package profiling
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"runtime/trace"
+	"sync"
+
+	"github.com/bassosimone/vflag"
+)
+
+// Flags contains the profiling flags.
+type Flags struct {
+	// CPUProfile is the file where to write the CPU profile.
+	CPUProfile string
+
+	// MemProfile is the file where to write the heap profile when stopping.
+	MemProfile string
+
+	// Pprof is the address where to serve net/http/pprof.
+	Pprof string
+
+	// Trace is the file where to write the execution trace.
+	Trace string
+}
+
+// AddFlags adds the profiling flags to the given [*vflag.FlagSet].
+func (f *Flags) AddFlags(fset *vflag.FlagSet) {
+	fset.StringVar(&f.CPUProfile, 0, "cpuprofile", "Write a CPU profile to `FILE`.")
+	fset.StringVar(&f.MemProfile, 0, "memprofile", "Write a heap profile to `FILE` when exiting.")
+	fset.StringVar(&f.Pprof, 0, "pprof", "Serve net/http/pprof at `ADDRESS` (e.g., 127.0.0.1:6060).")
+	fset.StringVar(&f.Trace, 0, "trace", "Write an execution trace to `FILE`.")
+}
+
+// Start starts profiling and returns the function to stop it, which the
+// caller must call before exiting to write the profiles. Calling it more
+// than once is safe, so the caller can both defer it and call it before
+// exiting with [os.Exit], which does not run the deferred calls.
+func (f *Flags) Start() (func(), error) {
+	var stops []func() error
+	stop := sync.OnceFunc(func() {
+		for idx := len(stops) - 1; idx >= 0; idx-- {
+			if err := stops[idx](); err != nil {
+				slog.Warn("cannot stop profiling", slog.Any("err", err))
+			}
+		}
+	})
+
+	if f.CPUProfile != "" {
+		filep, err := os.Create(f.CPUProfile)
+		if err != nil {
+			return nil, err
+		}
+		if err := runtimepprof.StartCPUProfile(filep); err != nil {
+			filep.Close()
+			return nil, err
+		}
+		slog.Info("writing CPU profile", slog.String("file", f.CPUProfile))
+		stops = append(stops, func() error {
+			runtimepprof.StopCPUProfile()
+			return filep.Close()
+		})
+	}
+
+	if f.Trace != "" {
+		filep, err := os.Create(f.Trace)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		if err := trace.Start(filep); err != nil {
+			filep.Close()
+			stop()
+			return nil, err
+		}
+		slog.Info("writing execution trace", slog.String("file", f.Trace))
+		stops = append(stops, func() error {
+			trace.Stop()
+			return filep.Close()
+		})
+	}
+
+	if f.Pprof != "" {
+		listener, err := net.Listen("tcp", f.Pprof)
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+		srv := &http.Server{Handler: mux}
+		go srv.Serve(listener)
+		slog.Info("serving pprof at", slog.String("addr", listener.Addr().String()))
+		stops = append(stops, srv.Close)
+	}
+
+	if f.MemProfile != "" {
+		stops = append(stops, func() error {
+			slog.Info("writing heap profile", slog.String("file", f.MemProfile))
+			filep, err := os.Create(f.MemProfile)
+			if err != nil {
+				return err
+			}
+			runtime.GC() // make sure the profile is up to date
+			return errors.Join(runtimepprof.WriteHeapProfile(filep), filep.Close())
+		})
+	}
+
+	return stop, nil
+}
@@ -3,37 +3,53 @@
 package slogging
 
 import (
+	"errors"
 	"io"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
 )
 
-// interval is the interval between each print
-const interval = 250 * time.Millisecond
+// DefaultInterval is the default interval between each print.
+const DefaultInterval = 250 * time.Millisecond
+
+// Sample is an instantaneous throughput sample.
+type Sample struct {
+	// Delta is the number of bytes transferred during the interval.
+	Delta int64 `json:"delta"`
+
+	// Elapsed is the time elapsed since the beginning of the transfer.
+	Elapsed time.Duration `json:"elapsed_ns"`
+
+	// Interval is the actual duration of the interval.
+	Interval time.Duration `json:"interval_ns"`
+
+	// Time is the time when the sample was collected.
+	Time time.Time `json:"time"`
+
+	// Total is the number of bytes transferred so far.
+	Total int64 `json:"total"`
+}
+
+// Speed returns the instantaneous speed during the interval in bit/s.
+func (s Sample) Speed() float64 {
+	return maybeSpeed(s.Delta, s.Time.Add(-s.Interval), s.Time)
+}
 
 // ReadCloser is an infinite [io.ReadCloser].
 //
 // Construct using [NewReadCloser].
 type ReadCloser struct {
-	delta int64
-	rc    io.ReadCloser
-	t0    time.Time
-	tot   int64
-	tprev time.Time
+	m  *meter
+	rc io.ReadCloser
 }
 
-// NewReadCloser constructs a new [*ReadCloser].
-func NewReadCloser(rc io.ReadCloser) *ReadCloser {
-	now := time.Now()
-	return &ReadCloser{
-		rc:    rc,
-		tprev: now,
-		delta: 0,
-		t0:    now,
-		tot:   0,
-	}
+// NewReadCloser constructs a new [*ReadCloser] collecting a [Sample]
+// every interval, or every [DefaultInterval] if interval is not positive.
+func NewReadCloser(rc io.ReadCloser, interval time.Duration) *ReadCloser {
+	return &ReadCloser{m: newMeter(interval), rc: rc}
 }
 
 var _ io.ReadCloser = &ReadCloser{}
@@ -41,28 +57,146 @@ var _ io.ReadCloser = &ReadCloser{}
 // Read implements [io.ReadCloser].
 func (r *ReadCloser) Read(data []byte) (int, error) {
 	count, err := r.rc.Read(data)
-	r.delta += int64(count)
-	r.tot += int64(count)
-	now := time.Now()
-	if now.Sub(r.tprev) >= interval {
-		r.emit("read", now)
-		r.delta = 0
-		r.tprev = now
-	}
+	r.m.update("read", count)
 	return count, err
 }
 
 // Close implements [io.ReadCloser].
 func (r *ReadCloser) Close() error {
-	r.emit("close", time.Now())
+	r.m.finish("close")
 	return r.rc.Close()
 }
 
-func (r *ReadCloser) emit(event string, now time.Time) {
+// Samples returns a copy of the samples collected so far.
+func (r *ReadCloser) Samples() []Sample {
+	return r.m.samplesCopy()
+}
+
+// Total returns the number of bytes read so far.
+func (r *ReadCloser) Total() int64 {
+	return r.m.total()
+}
+
+// Reader is an [io.Reader] instrumenting the sending side of a
+// transfer, such as the body of an HTTP request, where we cannot
+// observe the writes but can observe how fast the transport is
+// pulling bytes from the body.
+//
+// Construct using [NewReader].
+type Reader struct {
+	m *meter
+	r io.Reader
+}
+
+// NewReader constructs a new [*Reader] collecting a [Sample]
+// every interval, or every [DefaultInterval] if interval is not positive.
+func NewReader(r io.Reader, interval time.Duration) *Reader {
+	return &Reader{m: newMeter(interval), r: r}
+}
+
+var _ io.Reader = &Reader{}
+
+// Read implements [io.Reader].
+//
+// The first error returned by the underlying reader, including
+// [io.EOF], causes the final sample to be collected.
+func (r *Reader) Read(data []byte) (int, error) {
+	count, err := r.r.Read(data)
+	r.m.update("send", count)
+	if errors.Is(err, io.EOF) {
+		r.m.finish("eof")
+	} else if err != nil {
+		r.m.finish("error")
+	}
+	return count, err
+}
+
+// Samples returns a copy of the samples collected so far.
+func (r *Reader) Samples() []Sample {
+	return r.m.samplesCopy()
+}
+
+// Total returns the number of bytes read so far.
+func (r *Reader) Total() int64 {
+	return r.m.total()
+}
+
+// meter collects samples and logs the transfer speed.
+type meter struct {
+	delta    int64
+	done     bool
+	interval time.Duration
+	mu       sync.Mutex
+	samples  []Sample
+	t0       time.Time
+	tot      int64
+	tprev    time.Time
+}
+
+func newMeter(interval time.Duration) *meter {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	now := time.Now()
+	return &meter{
+		delta:    0,
+		interval: interval,
+		samples:  []Sample{},
+		t0:       now,
+		tot:      0,
+		tprev:    now,
+	}
+}
+
+func (m *meter) update(event string, count int) {
+	m.mu.Lock()
+	m.delta += int64(count)
+	m.tot += int64(count)
+	now := time.Now()
+	if now.Sub(m.tprev) >= m.interval {
+		m.emit(event, now)
+	}
+	m.mu.Unlock()
+}
+
+func (m *meter) finish(event string) {
+	m.mu.Lock()
+	if !m.done {
+		m.emit(event, time.Now())
+		m.done = true
+	}
+	m.mu.Unlock()
+}
+
+func (m *meter) samplesCopy() []Sample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Sample{}, m.samples...)
+}
+
+func (m *meter) total() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tot
+}
+
+func (m *meter) emit(event string, now time.Time) {
+	sample := Sample{
+		Delta:    m.delta,
+		Elapsed:  now.Sub(m.t0),
+		Interval: now.Sub(m.tprev),
+		Time:     now,
+		Total:    m.tot,
+	}
+	m.samples = append(m.samples, sample)
+	m.delta = 0
+	m.tprev = now
 	slog.Info(
 		event,
 		slog.Time("timeNow", now),
-		slog.String("Speed", humanize.SI(maybeSpeed(r.tot, r.t0, now), "bit/s")),
+		slog.String("Delta", humanize.IEC(float64(sample.Delta), "B")),
+		slog.String("IntervalSpeed", humanize.SI(sample.Speed(), "bit/s")),
+		slog.String("Speed", humanize.SI(maybeSpeed(m.tot, m.t0, now), "bit/s")),
 	)
 }
 
@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package slogging
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// The meters log each sample, which would drown the test output.
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+	os.Exit(m.Run())
+}
+
+// slowReader returns chunk bytes per read, sleeping for delay before each
+// read, until it has returned count bytes, then it returns err.
+type slowReader struct {
+	chunk int
+	count int
+	delay time.Duration
+	err   error
+}
+
+// Read implements [io.Reader].
+func (r *slowReader) Read(data []byte) (int, error) {
+	if r.count <= 0 {
+		return 0, r.err
+	}
+	time.Sleep(r.delay)
+	size := min(len(data), r.chunk, r.count)
+	r.count -= size
+	return size, nil
+}
+
+// checkSamples checks the invariants of the samples of a transfer of total
+// bytes collected every interval, where the last one is the final sample.
+func checkSamples(t *testing.T, samples []Sample, interval time.Duration, total int64) {
+	t.Helper()
+	if len(samples) <= 0 {
+		t.Fatal("expected at least the final sample")
+	}
+	var sum int64
+	var prev Sample
+	for idx, sample := range samples {
+		sum += sample.Delta
+		if sample.Total != sum {
+			t.Fatalf("sample %d: Total = %d, want %d", idx, sample.Total, sum)
+		}
+		if idx < len(samples)-1 && sample.Interval < interval {
+			t.Fatalf("sample %d: Interval = %v, want at least %v", idx, sample.Interval, interval)
+		}
+		if idx > 0 && sample.Elapsed != prev.Elapsed+sample.Interval {
+			t.Fatalf("sample %d: Elapsed = %v, want %v", idx, sample.Elapsed, prev.Elapsed+sample.Interval)
+		}
+		prev = sample
+	}
+	if sum != total {
+		t.Fatalf("sum of the deltas = %d, want %d", sum, total)
+	}
+}
+
+func TestReadCloser(t *testing.T) {
+	const (
+		chunk    = 1000
+		count    = 20 * chunk
+		interval = 20 * time.Millisecond
+	)
+	body := io.NopCloser(&slowReader{chunk: chunk, count: count, delay: 5 * time.Millisecond, err: io.EOF})
+	rc := NewReadCloser(body, interval)
+	if _, err := io.Copy(io.Discard, rc); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reads take about 100 ms, so we expect about four samples, but
+	// the final one only comes with Close and not with EOF.
+	samples := rc.Samples()
+	if len(samples) < 2 || len(samples) > 5 {
+		t.Fatalf("got %d samples before Close, want about 4", len(samples))
+	}
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	final := rc.Samples()
+	if len(final) != len(samples)+1 {
+		t.Fatalf("got %d samples after Close, want %d", len(final), len(samples)+1)
+	}
+	checkSamples(t, final, interval, count)
+	if rc.Total() != count {
+		t.Fatalf("Total() = %d, want %d", rc.Total(), count)
+	}
+
+	// Closing again does not collect another final sample.
+	rc.Close()
+	if got := len(rc.Samples()); got != len(final) {
+		t.Fatalf("got %d samples after the second Close, want %d", got, len(final))
+	}
+}
+
+func TestReader(t *testing.T) {
+	t.Run("final partial interval on EOF", func(t *testing.T) {
+		const count = 1 << 20
+		reader := NewReader(bytes.NewReader(make([]byte, count)), time.Hour)
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			t.Fatal(err)
+		}
+		samples := reader.Samples()
+		if len(samples) != 1 {
+			t.Fatalf("got %d samples, want only the final one", len(samples))
+		}
+		checkSamples(t, samples, time.Hour, count)
+		if reader.Total() != count {
+			t.Fatalf("Total() = %d, want %d", reader.Total(), count)
+		}
+
+		// Reading after EOF does not collect another final sample.
+		reader.Read(make([]byte, 1))
+		if got := len(reader.Samples()); got != 1 {
+			t.Fatalf("got %d samples after reading past EOF, want 1", got)
+		}
+	})
+
+	t.Run("interval bucketing", func(t *testing.T) {
+		const (
+			chunk    = 1000
+			count    = 20 * chunk
+			interval = 20 * time.Millisecond
+		)
+		reader := NewReader(&slowReader{chunk: chunk, count: count, delay: 5 * time.Millisecond, err: io.EOF}, interval)
+		if _, err := io.Copy(io.Discard, reader); err != nil {
+			t.Fatal(err)
+		}
+		samples := reader.Samples()
+		if len(samples) < 3 || len(samples) > 6 {
+			t.Fatalf("got %d samples, want about 5", len(samples))
+		}
+		checkSamples(t, samples, interval, count)
+	})
+
+	t.Run("final sample on error", func(t *testing.T) {
+		failure := errors.New("mocked error")
+		reader := NewReader(&slowReader{chunk: 10, count: 100, err: failure}, time.Hour)
+		if _, err := io.Copy(io.Discard, reader); !errors.Is(err, failure) {
+			t.Fatalf("expected %v, got %v", failure, err)
+		}
+		samples := reader.Samples()
+		if len(samples) != 1 {
+			t.Fatalf("got %d samples, want only the final one", len(samples))
+		}
+		checkSamples(t, samples, time.Hour, 100)
+	})
+
+	t.Run("default interval", func(t *testing.T) {
+		if reader := NewReader(bytes.NewReader(nil), 0); reader.m.interval != DefaultInterval {
+			t.Fatalf("interval = %v, want %v", reader.m.interval, DefaultInterval)
+		}
+	})
+}
+
+func TestSampleSpeed(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		sample Sample
+		want   float64
+	}{
+		{"one second", Sample{Delta: 1000, Interval: time.Second, Time: now}, 8000},
+		{"half second", Sample{Delta: 1000, Interval: 500 * time.Millisecond, Time: now}, 16000},
+		{"zero interval", Sample{Delta: 1000, Time: now}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sample.Speed(); got != tt.want {
+				t.Fatalf("Speed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package stats contains the descriptive statistics and the significance
+// test we use to compare repeated measurements.
+package stats
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// Confidence is the confidence level of [Summary] intervals.
+const Confidence = 0.95
+
+// Alpha is the significance level used by [Significant].
+const Alpha = 0.05
+
+// bootstrapResamples is the number of resamples used for the confidence interval.
+const bootstrapResamples = 10000
+
+// Summary contains descriptive statistics of a set of samples.
+type Summary struct {
+	// CIHigh is the upper bound of the bootstrap confidence interval of the median.
+	CIHigh float64 `json:"ci_high"`
+
+	// CILow is the lower bound of the bootstrap confidence interval of the median.
+	CILow float64 `json:"ci_low"`
+
+	// Count is the number of samples.
+	Count int `json:"count"`
+
+	// Max is the largest sample.
+	Max float64 `json:"max"`
+
+	// Mean is the arithmetic mean.
+	Mean float64 `json:"mean"`
+
+	// Median is the median.
+	Median float64 `json:"median"`
+
+	// Min is the smallest sample.
+	Min float64 `json:"min"`
+
+	// Stddev is the sample standard deviation.
+	Stddev float64 `json:"stddev"`
+}
+
+// Summarize computes the [*Summary] of the given samples.
+//
+// With no samples, we return a zero [*Summary]. The bootstrap uses a
+// fixed seed, so summarizing the same samples yields the same interval.
+func Summarize(samples []float64) *Summary {
+	if len(samples) <= 0 {
+		return &Summary{}
+	}
+	sorted := slices.Sorted(slices.Values(samples))
+
+	var sum float64
+	for _, value := range sorted {
+		sum += value
+	}
+	mean := sum / float64(len(sorted))
+	var squares float64
+	for _, value := range sorted {
+		squares += (value - mean) * (value - mean)
+	}
+	var stddev float64
+	if len(sorted) > 1 {
+		stddev = math.Sqrt(squares / float64(len(sorted)-1))
+	}
+
+	low, high := bootstrapMedian(sorted)
+	return &Summary{
+		CIHigh: high,
+		CILow:  low,
+		Count:  len(sorted),
+		Max:    sorted[len(sorted)-1],
+		Mean:   mean,
+		Median: median(sorted),
+		Min:    sorted[0],
+		Stddev: stddev,
+	}
+}
+
+// Median returns the median of the samples or NaN if there are none.
+func Median(samples []float64) float64 {
+	if len(samples) <= 0 {
+		return math.NaN()
+	}
+	return median(slices.Sorted(slices.Values(samples)))
+}
+
+// median returns the median of the sorted, non-empty samples.
+func median(sorted []float64) float64 {
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// bootstrapMedian returns the percentile bootstrap confidence interval
+// of the median of the sorted, non-empty samples.
+func bootstrapMedian(sorted []float64) (float64, float64) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	medians := make([]float64, bootstrapResamples)
+	resample := make([]float64, len(sorted))
+	for idx := range medians {
+		for jdx := range resample {
+			resample[jdx] = sorted[rng.IntN(len(sorted))]
+		}
+		slices.Sort(resample)
+		medians[idx] = median(resample)
+	}
+	slices.Sort(medians)
+	tail := (1 - Confidence) / 2
+	last := float64(len(medians) - 1)
+	low := medians[int(math.Floor(tail*last))]
+	high := medians[int(math.Ceil((1-tail)*last))]
+	return low, high
+}
+
+// Significant returns whether the difference between a and b is
+// significant at the [Alpha] level according to [UTest].
+func Significant(a, b []float64) bool {
+	return UTest(a, b) < Alpha
+}
+
+// UTest returns the two-sided p-value of the Mann-Whitney U test, which
+// checks whether a and b come from the same distribution without assuming
+// that the samples are normally distributed, like benchstat does.
+//
+// We compute the exact p-value for small samples without ties and
+// otherwise use the normal approximation with tie correction.
+func UTest(a, b []float64) float64 {
+	n1, n2 := len(a), len(b)
+	if n1 <= 0 || n2 <= 0 {
+		return 1
+	}
+
+	// Rank the pooled samples, assigning the average rank to ties.
+	type sample struct {
+		value float64
+		fromA bool
+	}
+	pooled := make([]sample, 0, n1+n2)
+	for _, value := range a {
+		pooled = append(pooled, sample{value, true})
+	}
+	for _, value := range b {
+		pooled = append(pooled, sample{value, false})
+	}
+	slices.SortFunc(pooled, func(x, y sample) int {
+		switch {
+		case x.value < y.value:
+			return -1
+		case x.value > y.value:
+			return 1
+		default:
+			return 0
+		}
+	})
+	var rankSumA, tieTerm float64
+	hasTies := false
+	for start := 0; start < len(pooled); {
+		end := start + 1
+		for end < len(pooled) && pooled[end].value == pooled[start].value {
+			end++
+		}
+		if count := float64(end - start); count > 1 {
+			hasTies = true
+			tieTerm += count*count*count - count
+		}
+		rank := float64(start+end+1) / 2 // average of the 1-based ranks start+1...end
+		for _, entry := range pooled[start:end] {
+			if entry.fromA {
+				rankSumA += rank
+			}
+		}
+		start = end
+	}
+	u := rankSumA - float64(n1*(n1+1))/2
+	u = min(u, float64(n1*n2)-u)
+
+	if !hasTies && n1+n2 <= 50 {
+		return min(1, 2*exactUCDF(n1, n2, int(u)))
+	}
+
+	n := float64(n1 + n2)
+	mean := float64(n1*n2) / 2
+	variance := float64(n1*n2) / 12 * ((n + 1) - tieTerm/(n*(n-1)))
+	if variance <= 0 {
+		return 1
+	}
+	z := (mean - u - 0.5) / math.Sqrt(variance) // with continuity correction
+	if z <= 0 {
+		return 1
+	}
+	return min(1, math.Erfc(z/math.Sqrt2))
+}
+
+// exactUCDF returns P(U <= u) for samples of size n1 and n2 without ties.
+func exactUCDF(n1, n2, u int) float64 {
+	// counts[i][j][k] is the number of arrangements of i samples from the first
+	// group and j from the second yielding U = k, computed using the recurrence
+	// on whether the largest sample belongs to the first or the second group.
+	counts := make([][][]float64, n1+1)
+	for i := range counts {
+		counts[i] = make([][]float64, n2+1)
+		for j := range counts[i] {
+			counts[i][j] = make([]float64, i*j+1)
+			if i == 0 || j == 0 {
+				counts[i][j][0] = 1
+				continue
+			}
+			for k := range counts[i][j] {
+				if k-j >= 0 && k-j < len(counts[i-1][j]) {
+					counts[i][j][k] += counts[i-1][j][k-j]
+				}
+				if k < len(counts[i][j-1]) {
+					counts[i][j][k] += counts[i][j-1][k]
+				}
+			}
+		}
+	}
+	var below, total float64
+	for k, count := range counts[n1][n2] {
+		if k <= u {
+			below += count
+		}
+		total += count
+	}
+	return below / total
+}
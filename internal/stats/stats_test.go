@@ -0,0 +1,166 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+// almostEqual returns whether got and want differ by less than 1e-9.
+func almostEqual(got, want float64) bool {
+	return math.Abs(got-want) < 1e-9
+}
+
+func TestMedian(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []float64
+		want    float64
+	}{
+		{"single", []float64{7}, 7},
+		{"odd", []float64{3, 1, 2}, 2},
+		{"even", []float64{4, 1, 3, 2}, 2.5},
+		{"duplicates", []float64{5, 1, 5, 5}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Median(tt.samples); got != tt.want {
+				t.Fatalf("Median(%v) = %v, want %v", tt.samples, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		if got := Median(nil); !math.IsNaN(got) {
+			t.Fatalf("Median(nil) = %v, want NaN", got)
+		}
+	})
+
+	t.Run("does not modify the samples", func(t *testing.T) {
+		samples := []float64{3, 1, 2}
+		Median(samples)
+		if samples[0] != 3 || samples[1] != 1 || samples[2] != 2 {
+			t.Fatalf("Median sorted the samples: %v", samples)
+		}
+	})
+}
+
+func TestSummarize(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		if got := Summarize(nil); *got != (Summary{}) {
+			t.Fatalf("Summarize(nil) = %+v, want zero", got)
+		}
+	})
+
+	t.Run("descriptive statistics", func(t *testing.T) {
+		got := Summarize([]float64{9, 2, 4, 4, 4, 5, 5, 7})
+		if got.Count != 8 || got.Min != 2 || got.Max != 9 || got.Mean != 5 || got.Median != 4.5 {
+			t.Fatalf("unexpected summary: %+v", got)
+		}
+		if want := math.Sqrt(32.0 / 7); !almostEqual(got.Stddev, want) {
+			t.Fatalf("Stddev = %v, want %v", got.Stddev, want)
+		}
+	})
+
+	t.Run("single sample", func(t *testing.T) {
+		got := Summarize([]float64{42})
+		want := Summary{CIHigh: 42, CILow: 42, Count: 1, Max: 42, Mean: 42, Median: 42, Min: 42}
+		if *got != want {
+			t.Fatalf("Summarize([42]) = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("reproducible confidence interval", func(t *testing.T) {
+		samples := []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}
+		got := Summarize(samples)
+		// These values depend on the fixed seed of the bootstrap.
+		if got.CILow != 3 || got.CIHigh != 8 {
+			t.Fatalf("CI = [%v, %v], want [3, 8]", got.CILow, got.CIHigh)
+		}
+		if again := Summarize(samples); *again != *got {
+			t.Fatalf("Summarize is not reproducible: %+v != %+v", again, got)
+		}
+	})
+}
+
+func TestUTest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		want float64
+	}{
+		// Exact: the only arrangement with U = 0 out of C(6, 3) = 20.
+		{"exact 3x3 separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 2.0 / 20},
+
+		// Exact: the only arrangement with U = 0 out of C(8, 4) = 70.
+		{"exact 4x4 separated", []float64{1, 2, 3, 4}, []float64{5, 6, 7, 8}, 2.0 / 70},
+
+		// Exact: the only arrangement with U = 0 out of C(10, 5) = 252.
+		{"exact 5x5 separated", []float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}, 2.0 / 252},
+
+		// Exact: U = 3 and 1+1+2+3 of the 20 arrangements have U <= 3.
+		{"exact 3x3 interleaved", []float64{1, 3, 5}, []float64{2, 4, 6}, 2 * 7.0 / 20},
+
+		// Exact: the p-value is capped at one.
+		{"exact 1x1", []float64{1}, []float64{2}, 1},
+
+		// Normal approximation with tie correction: the ranks are 1.5 for the
+		// ones, 4.5 for the twos, and 7.5 for the threes, so U = 12 - 10 = 2,
+		// the tie term is 6 + 60 + 6 = 72, and z = 5.5 / sqrt(16/12 * (9 - 72/56)).
+		{"normal with ties", []float64{1, 1, 2, 2}, []float64{2, 2, 3, 3}, 0.08635873964701243},
+
+		// Normal approximation with all the samples tied.
+		{"all tied", []float64{1, 1}, []float64{1, 1}, 1},
+
+		{"empty a", nil, []float64{1, 2}, 1},
+		{"empty b", []float64{1, 2}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UTest(tt.a, tt.b); !almostEqual(got, tt.want) {
+				t.Fatalf("UTest(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := UTest(tt.b, tt.a); !almostEqual(got, tt.want) {
+				t.Fatalf("UTest(%v, %v) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("normal without ties for large samples", func(t *testing.T) {
+		var a, b []float64
+		for idx := range 30 {
+			a = append(a, float64(idx))
+			b = append(b, float64(idx+30))
+		}
+		// U = 0, mean = 450, variance = 900 / 12 * 61 = 4575.
+		want := math.Erfc((450 - 0.5) / math.Sqrt(4575) / math.Sqrt2)
+		if got := UTest(a, b); !almostEqual(got, want) {
+			t.Fatalf("UTest = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestExactUCDF(t *testing.T) {
+	// The distribution of U for n1 = n2 = 3 out of 20 arrangements.
+	counts := []float64{1, 1, 2, 3, 3, 3, 3, 2, 1, 1}
+	var below float64
+	for u, count := range counts {
+		below += count
+		if got, want := exactUCDF(3, 3, u), below/20; !almostEqual(got, want) {
+			t.Fatalf("exactUCDF(3, 3, %d) = %v, want %v", u, got, want)
+		}
+	}
+	if got := exactUCDF(2, 4, 0); !almostEqual(got, 1.0/15) {
+		t.Fatalf("exactUCDF(2, 4, 0) = %v, want %v", got, 1.0/15)
+	}
+}
+
+func TestSignificant(t *testing.T) {
+	if !Significant([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10}) {
+		t.Fatal("expected a significant difference")
+	}
+	if Significant([]float64{1, 3, 5}, []float64{2, 4, 6}) {
+		t.Fatal("expected no significant difference")
+	}
+}
@@ -0,0 +1,197 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package tcpinfo periodically samples TCP_INFO from a connection.
+package tcpinfo
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bassosimone/2026-02-http2-perf/internal/humanize"
+)
+
+// Sample is a TCP_INFO sample.
+//
+// Times are converted from microseconds to [time.Duration] and rates
+// are expressed in bytes per second, like the kernel does.
+type Sample struct {
+	// BBR contains the BBR state, if the connection uses BBR.
+	BBR *BBRInfo `json:"bbr,omitempty"`
+
+	// BusyTime is the time spent actively sending data.
+	BusyTime time.Duration `json:"busy_time_ns"`
+
+	// BytesAcked is the number of bytes acknowledged by the peer.
+	BytesAcked uint64 `json:"bytes_acked"`
+
+	// BytesReceived is the number of bytes received from the peer.
+	BytesReceived uint64 `json:"bytes_received"`
+
+	// BytesRetrans is the number of bytes retransmitted.
+	BytesRetrans uint64 `json:"bytes_retrans"`
+
+	// BytesSent is the number of bytes sent, including retransmissions.
+	BytesSent uint64 `json:"bytes_sent"`
+
+	// DeliveryRate is the most recent goodput estimate.
+	DeliveryRate uint64 `json:"delivery_rate"`
+
+	// Elapsed is the time elapsed since sampling started.
+	Elapsed time.Duration `json:"elapsed_ns"`
+
+	// MinRTT is the minimum observed RTT.
+	MinRTT time.Duration `json:"min_rtt_ns"`
+
+	// NotsentBytes is the number of bytes in the send buffer not sent yet.
+	NotsentBytes uint32 `json:"notsent_bytes"`
+
+	// PacingRate is the current pacing rate.
+	PacingRate uint64 `json:"pacing_rate"`
+
+	// RTT is the smoothed RTT.
+	RTT time.Duration `json:"rtt_ns"`
+
+	// RTTVar is the RTT variance.
+	RTTVar time.Duration `json:"rttvar_ns"`
+
+	// RcvWnd is the receive window we advertise.
+	RcvWnd uint32 `json:"rcv_wnd"`
+
+	// RwndLimited is the time spent limited by the peer's receive window.
+	RwndLimited time.Duration `json:"rwnd_limited_ns"`
+
+	// SndCwnd is the congestion window in segments.
+	SndCwnd uint32 `json:"snd_cwnd"`
+
+	// SndMSS is the sender maximum segment size.
+	SndMSS uint32 `json:"snd_mss"`
+
+	// SndWnd is the receive window advertised by the peer.
+	SndWnd uint32 `json:"snd_wnd"`
+
+	// SndbufLimited is the time spent limited by the send buffer.
+	SndbufLimited time.Duration `json:"sndbuf_limited_ns"`
+
+	// TotalRetrans is the total number of retransmitted segments.
+	TotalRetrans uint32 `json:"total_retrans"`
+}
+
+// BBRInfo is the TCP_CC_INFO of a connection using BBR.
+type BBRInfo struct {
+	// BW is the estimated bottleneck bandwidth in bytes per second.
+	BW uint64 `json:"bw"`
+
+	// CwndGain is the congestion window gain scaled by 256.
+	CwndGain uint32 `json:"cwnd_gain"`
+
+	// MinRTT is the estimated minimum RTT.
+	MinRTT time.Duration `json:"min_rtt_ns"`
+
+	// PacingGain is the pacing gain scaled by 256.
+	PacingGain uint32 `json:"pacing_gain"`
+}
+
+// Get returns a single TCP_INFO sample of conn, whose Elapsed is zero.
+func Get(conn net.Conn) (*Sample, error) {
+	rc, err := rawConn(conn)
+	if err != nil {
+		return nil, err
+	}
+	return getsockopt(rc)
+}
+
+// Sampler periodically samples TCP_INFO.
+//
+// Construct using [Start].
+type Sampler struct {
+	done    chan struct{}
+	mu      sync.Mutex
+	samples []Sample
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// Start starts sampling TCP_INFO from conn every interval in a background
+// goroutine. If sampling is not possible, because we are not on Linux or
+// conn is not a TCP connection, the returned [*Sampler] collects nothing.
+func Start(conn net.Conn, interval time.Duration) *Sampler {
+	s := &Sampler{
+		done:    make(chan struct{}),
+		samples: []Sample{},
+		stop:    make(chan struct{}),
+	}
+	go s.loop(conn, interval)
+	return s
+}
+
+// Stop stops sampling and returns a copy of the collected samples.
+func (s *Sampler) Stop() []Sample {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Sample{}, s.samples...)
+}
+
+func (s *Sampler) loop(conn net.Conn, interval time.Duration) {
+	defer close(s.done)
+	rc, err := rawConn(conn)
+	if err != nil {
+		slog.Info("tcpinfo", slog.Any("err", err))
+		return
+	}
+	t0 := time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			s.collect(rc, t0) // make sure we have a final sample
+			return
+		}
+		if err := s.collect(rc, t0); err != nil {
+			slog.Info("tcpinfo", slog.Any("err", err))
+			return
+		}
+	}
+}
+
+func (s *Sampler) collect(rc syscall.RawConn, t0 time.Time) error {
+	sample, err := getsockopt(rc)
+	if err != nil {
+		return err
+	}
+	sample.Elapsed = time.Since(t0)
+	s.mu.Lock()
+	s.samples = append(s.samples, *sample)
+	s.mu.Unlock()
+	slog.Info("tcpinfo",
+		slog.Duration("rtt", sample.RTT),
+		slog.Uint64("cwnd", uint64(sample.SndCwnd)),
+		slog.String("deliveryRate", humanize.SI(float64(sample.DeliveryRate)*8, "bit/s")),
+		slog.Duration("busyTime", sample.BusyTime),
+		slog.Duration("rwndLimited", sample.RwndLimited),
+		slog.Duration("sndbufLimited", sample.SndbufLimited),
+		slog.Uint64("totalRetrans", uint64(sample.TotalRetrans)),
+	)
+	return nil
+}
+
+// rawConn unwraps conn until it finds a [syscall.Conn].
+func rawConn(conn net.Conn) (syscall.RawConn, error) {
+	for {
+		switch c := conn.(type) {
+		case syscall.Conn:
+			return c.SyscallConn()
+		case interface{ NetConn() net.Conn }: // e.g., *tls.Conn
+			conn = c.NetConn()
+		default:
+			return nil, errors.New("tcpinfo: cannot find the underlying socket")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build linux
+
+package tcpinfo
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func getsockopt(rc syscall.RawConn) (*Sample, error) {
+	var (
+		bbr  *unix.TCPBBRInfo
+		info *unix.TCPInfo
+		err  error
+	)
+	ctrlErr := rc.Control(func(fd uintptr) {
+		info, err = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return
+		}
+		// TCP_CC_INFO depends on the congestion control, so we only read it
+		// for BBR, ignoring errors since it is optional.
+		cc, ccErr := unix.GetsockoptString(int(fd), unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+		if ccErr == nil && cc == "bbr" {
+			if value, ccErr := unix.GetsockoptTCPCCBBRInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_CC_INFO); ccErr == nil {
+				bbr = value
+			}
+		}
+	})
+	if ctrlErr != nil {
+		return nil, ctrlErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sample := &Sample{
+		BusyTime:      microseconds(info.Busy_time),
+		BytesAcked:    info.Bytes_acked,
+		BytesReceived: info.Bytes_received,
+		BytesRetrans:  info.Bytes_retrans,
+		BytesSent:     info.Bytes_sent,
+		DeliveryRate:  info.Delivery_rate,
+		MinRTT:        microseconds(uint64(info.Min_rtt)),
+		NotsentBytes:  info.Notsent_bytes,
+		PacingRate:    info.Pacing_rate,
+		RTT:           microseconds(uint64(info.Rtt)),
+		RTTVar:        microseconds(uint64(info.Rttvar)),
+		RcvWnd:        info.Rcv_wnd,
+		RwndLimited:   microseconds(info.Rwnd_limited),
+		SndCwnd:       info.Snd_cwnd,
+		SndMSS:        info.Snd_mss,
+		SndWnd:        info.Snd_wnd,
+		SndbufLimited: microseconds(info.Sndbuf_limited),
+		TotalRetrans:  info.Total_retrans,
+	}
+	if bbr != nil {
+		sample.BBR = &BBRInfo{
+			BW:         uint64(bbr.Bw_hi)<<32 | uint64(bbr.Bw_lo),
+			CwndGain:   bbr.Cwnd_gain,
+			MinRTT:     microseconds(uint64(bbr.Min_rtt)),
+			PacingGain: bbr.Pacing_gain,
+		}
+	}
+	return sample, nil
+}
+
+func microseconds(value uint64) time.Duration {
+	return time.Duration(value) * time.Microsecond
+}
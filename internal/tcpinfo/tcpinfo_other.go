@@ -0,0 +1,14 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build !linux
+
+package tcpinfo
+
+import (
+	"errors"
+	"syscall"
+)
+
+func getsockopt(rc syscall.RawConn) (*Sample, error) {
+	return nil, errors.ErrUnsupported
+}